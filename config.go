@@ -15,6 +15,11 @@ var (
 	reindex        bool
 )
 
+const (
+	slotLostReindex = "reindex"
+	slotLostFail    = "fail"
+)
+
 func init() {
 	flag.BoolVar(&pgSlotCreate, "create", false, "Create new replication slot, if specified slot does not exists.")
 	flag.BoolVar(&pgSlotReCreate, "recreate", false, "Deletes slot and creates new one.")
@@ -26,8 +31,34 @@ type Config struct {
 	Postgres struct {
 		// Postgres replication slot. Used to control WAL positions.
 		Slot string `envconfig:"PG_SLOT" default:"pg2es"`
-		// PostgresPublication containing databases and tables that should be replicated or indexed by the search engine.
-		Publication string `envconfig:"PG_PUBLICATION" default:"search"`
+		// SlotLost defines what to do, when replication slot is lost (WAL required by slot was removed). [ reindex (default) | fail ]
+		SlotLost string `envconfig:"PG_SLOT_LOST" default:"reindex"`
+		// LeaderElection allows multiple replicas (active/standby) for the same slot. Only the leader streams.
+		LeaderElection bool `envconfig:"PG_LEADER_ELECTION" default:"false"`
+		// LeaderPollInterval how often standby replica checks whether leader is gone.
+		LeaderPollInterval time.Duration `envconfig:"PG_LEADER_POLL_INTERVAL" default:"2s"`
+		// Publications (comma separated) containing databases and tables that should be replicated or indexed by the search engine.
+		Publications []string `envconfig:"PG_PUBLICATION" default:"search"`
+		// HeartbeatInterval between writes into WAL, which advance slot position when published tables are idle. Zero disables heartbeats.
+		HeartbeatInterval time.Duration `envconfig:"PG_HEARTBEAT_INTERVAL" default:"0"`
+		// HeartbeatTable (optional) with `slot_name` PK and `beat_at` timestamptz columns. Should be included into publication.
+		// By default pg_logical_emit_message is used instead.
+		HeartbeatTable string `envconfig:"PG_HEARTBEAT_TABLE"`
+		// PublicationCheckInterval how often published tables are checked, to discover tables added at runtime. Zero disables checks.
+		PublicationCheckInterval time.Duration `envconfig:"PG_PUBLICATION_CHECK_INTERVAL" default:"1m"`
+		// Backfill copies existing rows of tables, added to publication at runtime.
+		Backfill bool `envconfig:"PG_BACKFILL" default:"true"`
+		// Slot health checks. Zero thresholds are disabled.
+		SlotCheckInterval   time.Duration `envconfig:"PG_SLOT_CHECK_INTERVAL" default:"30s"`
+		SlotLagWarn         int64         `envconfig:"PG_SLOT_LAG_WARN" default:"0"`     // bytes
+		SlotLagCritical     int64         `envconfig:"PG_SLOT_LAG_CRITICAL" default:"0"` // bytes
+		SlotLagTimeWarn     time.Duration `envconfig:"PG_SLOT_LAG_TIME_WARN" default:"0"`
+		SlotLagTimeCritical time.Duration `envconfig:"PG_SLOT_LAG_TIME_CRITICAL" default:"0"`
+		SlotSafeWALWarn     int64         `envconfig:"PG_SLOT_SAFE_WAL_WARN" default:"0"`     // minimal remaining safe_wal_size in bytes
+		SlotSafeWALCritical int64         `envconfig:"PG_SLOT_SAFE_WAL_CRITICAL" default:"0"` // minimal remaining safe_wal_size in bytes
+		// SlotPauseReindex pauses online backfill while slot health is critical.
+		SlotPauseReindex bool `envconfig:"PG_SLOT_PAUSE_REINDEX" default:"false"`
+
 		// PostgreSQL connection string
 		// Host string `encvonfig:"PGHOST" required:"true"`
 		Host string `envconfig:"PGHOST"`
@@ -60,14 +91,22 @@ type Config struct {
 		PushInterval time.Duration `envconfig:"SEARCH_PUSH_INTERVAL" default:"30s"`
 		PushThrottle time.Duration `envconfig:"SEARCH_PUSH_THROTTLE" default:"500ms"`
 		PushDebounce time.Duration `envconfig:"SEARCH_PUSH_DEBOUNCE" default:"500ms"`
+		// ExternalVersion uses commit LSN as external document version, so stale replayed or retried operations are rejected.
+		ExternalVersion bool `envconfig:"SEARCH_EXTERNAL_VERSION" default:"false"`
 	}
 
+	// ConfigFile (optional) YAML or JSON config of tables and columns. Alternative to comments.
+	ConfigFile string `envconfig:"CONFIG_FILE"`
+
 	// LogFormat [ json (default) | cli ]
 	LogFormat string `envconfig:"LOG_FORMAT" default:"json"`
 	LogLevel  string `envconfig:"LOG_LEVEL" default:"warn"`
 
 	// Internal http API and metrics. Default 0.0.0.0:80
 	Address string `envconfig:"ADDR"`
+
+	// ShutdownTimeout limits graceful shutdown: flushing documents and acknowledging LSN.
+	ShutdownTimeout time.Duration `envconfig:"SHUTDOWN_TIMEOUT" default:"30s"`
 }
 
 // FromEnv loads the configuration from environment variables. Panics if can not config us invalid
@@ -76,5 +115,8 @@ func FromEnv() *Config {
 	if err := envconfig.Process("", &cfg); err != nil {
 		log.Fatal(fmt.Errorf("can not read initial config: %w", err))
 	}
+	if cfg.Postgres.SlotLost != slotLostReindex && cfg.Postgres.SlotLost != slotLostFail {
+		log.Fatalf("invalid PG_SLOT_LOST value %q: reindex or fail expected", cfg.Postgres.SlotLost)
+	}
 	return &cfg
 }
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/pg2es/search-replica/postgres"
+)
+
+// doctor subcommand checks database setup, and prints SQL which fixes found problems.
+// With -apply flag, fixes are applied. Returns exit code.
+func doctor(cfg *Config, logger *zap.Logger, args []string) int {
+	fs := flag.NewFlagSet("doctor", flag.ExitOnError)
+	apply := fs.Bool("apply", false, "Apply printed SQL.")
+	publish := fs.String("publish", "", "Comma separated tables (schema.table) for created publication. All tables by default.")
+	fs.Parse(args)
+
+	ctx := context.Background()
+	db := postgres.New(nil, logger)
+	db.SlotName = cfg.Postgres.Slot
+	db.Publications = cfg.Postgres.Publications
+	db.HeartbeatTable = cfg.Postgres.HeartbeatTable
+	db.ConfigFile = cfg.ConfigFile
+	if err := db.Connect(ctx); err != nil {
+		logger.Fatal("connect to DB", zap.Error(err))
+	}
+	defer db.Close(ctx)
+
+	opts := postgres.DoctorOpts{}
+	if *publish != "" {
+		opts.PublishTables = strings.Split(*publish, ",")
+	}
+	problems, err := db.Doctor(ctx, opts)
+	if err != nil {
+		logger.Fatal("doctor", zap.Error(err))
+	}
+	if len(problems) == 0 {
+		fmt.Println("-- no problems found")
+		return exitOK
+	}
+
+	// Output is valid SQL script, E.G: `search-replica doctor | psql`
+	for _, p := range problems {
+		fmt.Printf("-- %s\n", p)
+		if p.SQL != "" {
+			fmt.Printf("%s;\n", p.SQL)
+		}
+	}
+	if !*apply {
+		return exitError
+	}
+
+	for _, p := range problems {
+		if err := db.Fix(ctx, p); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitError
+		}
+	}
+	fmt.Println("-- applied; run doctor again, since tables are discovered via publication")
+	return exitOK
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+
+	"github.com/pg2es/search-replica/postgres"
+)
+
+// export subcommand prints effective config (comments merged with config file),
+// as config file (yaml, json) or as `COMMENT ON` statements (sql). Returns exit code.
+func export(cfg *Config, logger *zap.Logger, args []string) int {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	format := fs.String("format", "yaml", "Output format: yaml, json or sql.")
+	fs.Parse(args)
+
+	ctx := context.Background()
+	db := postgres.New(nil, logger)
+	db.Publications = cfg.Postgres.Publications
+	db.HeartbeatTable = cfg.Postgres.HeartbeatTable
+	db.ConfigFile = cfg.ConfigFile
+	if err := db.Connect(ctx); err != nil {
+		logger.Fatal("connect to DB", zap.Error(err))
+	}
+	defer db.Close(ctx)
+
+	if err := db.Discover(ctx); err != nil {
+		logger.Fatal("discover config", zap.Error(err))
+	}
+	fileConfig, err := db.ExportConfig()
+	if err != nil {
+		logger.Fatal("export config", zap.Error(err))
+	}
+
+	switch *format {
+	case "yaml":
+		enc := yaml.NewEncoder(os.Stdout)
+		enc.SetIndent(2)
+		err = enc.Encode(fileConfig)
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(fileConfig)
+	case "sql":
+		for _, statement := range fileConfig.Comments() {
+			fmt.Printf("%s;\n", statement)
+		}
+	default:
+		err = fmt.Errorf("unknown format %q", *format)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	return exitOK
+}
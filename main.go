@@ -12,6 +12,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"net/http"
 	"os"
@@ -31,6 +32,13 @@ import (
 
 var Version = "master"
 
+// exit codes
+const (
+	exitOK      = 0
+	exitError   = 1 // graceful shutdown with errors; some documents might be streamed again after restart
+	exitTimeout = 2 // shutdown deadline exceeded; documents which were not pushed are discarded
+)
+
 func initLogger(format, level string) (logger *zap.Logger, err error) {
 	cfg := zap.NewProductionConfig() // default
 	if format == "cli" {
@@ -54,13 +62,26 @@ func main() {
 
 	logger, _ := initLogger(cfg.LogFormat, cfg.LogLevel)
 	defer logger.Sync()
+
+	switch flag.Arg(0) {
+	case "doctor":
+		code := doctor(cfg, logger, flag.Args()[1:])
+		logger.Sync()
+		os.Exit(code)
+	case "export":
+		code := export(cfg, logger, flag.Args()[1:])
+		logger.Sync()
+		os.Exit(code)
+	}
 	logger.Info("Starting the SearchReplica", zap.String("version", Version))
 
+	// ctx stops replication, reindexing and background tasks; abortCtx discards documents which are not pushed yet.
 	ctx, rootCancel := context.WithCancel(context.Background())
-	wg := &sync.WaitGroup{}
-	// TODO: waitgroups and graceful shutdown
+	abortCtx, abort := context.WithCancel(context.Background())
+	wg := &sync.WaitGroup{}       // postgres: document producers and background tasks
+	searchWG := &sync.WaitGroup{} // search: document consumer
 
-	stream := postgres.NewStreamPipe(ctx)
+	stream := postgres.NewStreamPipe(abortCtx)
 
 	searchClient, err := search.NewElastic(search.BulkElasticOpts{
 		Host:         cfg.Search.URL,
@@ -80,25 +101,47 @@ func main() {
 	if err := searchClient.PrepareScripts(); err != nil {
 		logger.Fatal(err.Error())
 	}
-	searchClient.Start(wg, ctx)
+	searchClient.Start(searchWG, abortCtx)
 
 	db := postgres.New(stream, logger)
 	db.SlotName = cfg.Postgres.Slot
-	db.Publication = cfg.Postgres.Publication
+	db.Publications = cfg.Postgres.Publications
+	db.ConfigFile = cfg.ConfigFile
+	db.HeartbeatInterval = cfg.Postgres.HeartbeatInterval
+	db.HeartbeatTable = cfg.Postgres.HeartbeatTable
+	db.PublicationCheckInterval = cfg.Postgres.PublicationCheckInterval
+	db.Backfill = cfg.Postgres.Backfill
+	db.ExternalVersion = cfg.Search.ExternalVersion
+	db.SlotMonitor = postgres.SlotMonitorOpts{
+		Interval:        cfg.Postgres.SlotCheckInterval,
+		LagWarn:         cfg.Postgres.SlotLagWarn,
+		LagCritical:     cfg.Postgres.SlotLagCritical,
+		LagTimeWarn:     cfg.Postgres.SlotLagTimeWarn,
+		LagTimeCritical: cfg.Postgres.SlotLagTimeCritical,
+		SafeWALWarn:     cfg.Postgres.SlotSafeWALWarn,
+		SafeWALCritical: cfg.Postgres.SlotSafeWALCritical,
+		PauseReindex:    cfg.Postgres.SlotPauseReindex,
+	}
 	if err := db.Connect(ctx); err != nil { // implicitly uses PG* env variables
 		logger.Fatal("connect to DB", zap.Error(err))
 	}
-	defer db.Close(ctx)
 
 	if err := db.Discover(ctx); err != nil {
 		logger.Fatal("discover config", zap.Error(err))
 	}
 
-	db.RegisterSlotLagMetric(ctx)
+	if err := db.Init(); err != nil {
+		logger.Fatal("invalid table config", zap.Error(err))
+	}
 	db.PrintSatus()
+	if err := db.ValidateJoins(); err != nil {
+		logger.Fatal("invalid join config", zap.Error(err))
+	}
 
 	mux := http.NewServeMux()
 	mux.HandleFunc("/state", stateFunc)
+	mux.HandleFunc("/health", healthFunc(db))
+	mux.HandleFunc("/api/reload", reloadFunc(db))
 	mux.HandleFunc("/api/", func(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "not implemented", http.StatusNotImplemented)
 	})
@@ -109,15 +152,20 @@ func main() {
 	//
 	// API & Metrics
 	//
-	wg.Add(1)
 	go func() {
 		if err := server.ListenAndServe(); err != http.ErrServerClosed {
 			logger.Error("API server closed with error", zap.Error(err))
 		} // TODO: tls?
-		wg.Done()
 	}()
 
 	startupDone := make(chan struct{})
+	reindexIncomplete := false // slot is created, but snapshot is not fully copied; read after wg.Wait()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		db.MonitorSlot(ctx) // slot lag metrics and health
+	}()
 
 	wg.Add(1)
 	go func() {
@@ -125,23 +173,58 @@ func main() {
 		defer state.Store("started up")
 		defer close(startupDone) // unlock streaming replication
 
+		if cfg.Postgres.LeaderElection {
+			state.Store("standby")
+			if err := db.AcquireLeadership(ctx, cfg.Postgres.LeaderPollInterval); err != nil {
+				if ctx.Err() == nil {
+					logger.Fatal("leader election", zap.Error(err))
+				}
+				return // shutting down in standby
+			}
+		}
+
+		slot, err := db.CheckSlot(ctx)
+		switch {
+		case errors.Is(err, postgres.ErrSlotNotFound):
+			if !pgSlotCreate && !pgSlotReCreate && !reindex {
+				logger.Fatal("replication slot does not exist; use -create flag", zap.String("slot", db.SlotName))
+			}
+		case err != nil: // slot is used by another replica, or belongs to something else
+			logger.Fatal("can not use replication slot", zap.Error(err))
+		case slot.Lost():
+			if cfg.Postgres.SlotLost != slotLostReindex {
+				logger.Fatal("replication slot is lost", zap.String("slot", slot.Name), zap.String("wal_status", slot.WALStatus))
+			}
+			// Streaming from lost slot would silently skip changes. Start from scratch instead.
+			logger.Warn("replication slot is lost; recreating it and reindexing", zap.String("slot", slot.Name), zap.String("wal_status", slot.WALStatus))
+			pgSlotReCreate, reindex = true, true
+		}
+
 		pgSlotReCreate = pgSlotReCreate || reindex
-		if pgSlotReCreate {
-			db.DropReplicationSlot(ctx)
-			pgSlotCreate = true
+		if slot != nil && pgSlotReCreate {
+			if err := db.DropReplicationSlot(ctx); err != nil {
+				logger.Fatal("drop replication slot", zap.Error(err))
+			}
 		}
 		// During slot creation, Postgres also make a spanshot of a database. Freezeng a state for the following COPY command  or backup. Snapshot is available within this transaction.
 		if err := db.Tx(ctx); err != nil {
 			logger.Fatal("start transaction", zap.Error(err))
 		}
-		if pgSlotCreate {
-			db.CreateReplicationSlot(ctx)
+		if slot == nil || pgSlotReCreate {
+			if err := db.CreateReplicationSlot(ctx); err != nil {
+				logger.Fatal("create replication slot", zap.Error(err))
+			}
 		}
 
 		if reindex {
 			logger.Info("REINDEXING DATA")
 			state.Store("reindexing")
 			if err := db.Reindex(ctx); err != nil { // blocking; should be called in same transaction as slot creation
+				if ctx.Err() != nil {
+					logger.Error("reindexing interrupted by shutdown; index is incomplete, slot is dropped, and next start needs -reindex", zap.Error(err))
+					reindexIncomplete = true
+					return
+				}
 				logger.Fatal("reindexing failed", zap.Error(err))
 			}
 			state.Store("reindexing: done")
@@ -160,6 +243,9 @@ func main() {
 	go func() {
 		defer wg.Done()
 		<-startupDone // wait for subscription and initial reindexing
+		if ctx.Err() != nil {
+			return // shutting down before streaming was started
+		}
 		// Zero value means: Get last committed position for this slot from master
 		state.Store("streaming wal")
 		if err = db.StartReplication(ctx, pglogrepl.LSN(0)); err != nil {
@@ -167,6 +253,29 @@ func main() {
 		}
 	}()
 
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		<-startupDone     // only leader writes heartbeats
+		db.Heartbeat(ctx) // no-op if disabled
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		<-startupDone            // reload is applied by streaming leader
+		db.WatchPublication(ctx) // no-op if disabled
+	}()
+
+	go func() {
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		for range hup {
+			logger.Info("config reload requested by SIGHUP")
+			db.RequestReload() // result is logged
+		}
+	}()
+
 	ch := make(chan os.Signal, 1)
 	signal.Notify(ch, os.Interrupt, syscall.SIGTERM)
 	<-ch // lock here
@@ -175,18 +284,48 @@ func main() {
 		logger.Fatal("received second signal; Dying now!")
 	}()
 	state.Store("shutting down")
-	logger.Info("shutting down gracefully")
-	// TODO:
-	// push to elastic
-	// commit LSN to PG
-	// die
-	rootCancel() // canceling root context
-
-	// shutdown
-	wtimeout, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	server.Shutdown(wtimeout)
-	cancel()
+	logger.Info("shutting down gracefully", zap.Duration("timeout", cfg.ShutdownTimeout))
+
+	// Hard deadline for the whole shutdown sequence.
+	time.AfterFunc(cfg.ShutdownTimeout, func() {
+		abort()
+		logger.Error("graceful shutdown timed out; documents which are not pushed yet are discarded")
+		logger.Sync()
+		os.Exit(exitTimeout)
+	})
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
 
+	exitCode := exitOK
+
+	rootCancel() // stop receiving WAL, reindexing and background tasks
 	wg.Wait()
 
+	stream.Close() // drain documents and push final bulk
+	searchWG.Wait()
+
+	if reindexIncomplete {
+		// Streaming from this slot would skip rows, which are not copied. Next start creates slot and reindexes from scratch.
+		exitCode = exitError
+		if err := db.DropSlot(shutdownCtx); err != nil {
+			logger.Error("drop replication slot of incomplete reindex; drop it manually, or start with -reindex", zap.Error(err))
+		}
+	}
+	// Only pushed documents are acknowledged. The rest would be streamed again after restart.
+	if err := db.Acknowledge(shutdownCtx); err != nil {
+		logger.Error("acknowledge latest position", zap.Error(err))
+		exitCode = exitError
+	}
+	if err := db.Close(shutdownCtx); err != nil {
+		logger.Error("close database connections", zap.Error(err))
+		exitCode = exitError
+	}
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		logger.Error("API server shutdown", zap.Error(err))
+		exitCode = exitError
+	}
+
+	logger.Info("shutdown complete", zap.Int("exit_code", exitCode))
+	logger.Sync()
+	os.Exit(exitCode)
 }
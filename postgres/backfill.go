@@ -0,0 +1,185 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pglogrepl"
+	"github.com/jackc/pgtype"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+var (
+	metricBackfills = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "backfills",
+		Help: "Online backfills of tables, added to publication at runtime",
+	}, []string{"table", "status"})
+)
+
+func init() {
+	prometheus.MustRegister(metricBackfills)
+}
+
+// publishedTablesQuery lists tables of publication as `schema.table`
+const publishedTablesQuery = `SELECT DISTINCT schemaname || '.' || tablename FROM pg_publication_tables WHERE pubname = ANY($1::text[])`
+
+// fork creates independent config tree with own query connection, which is safe to use aside of replication.
+// Slot health and announced indices are shared with parent.
+func (db *Database) fork(conn *pgconn.PgConn) *Database {
+	return &Database{
+		name:              db.name,
+		schemas:           make(map[string]*Schema),
+		relationSet:       make(map[uint32]*Table),
+		queryConn:         conn,
+		connInfo:          pgtype.NewConnInfo(),
+		version:           db.version,
+		major:             db.major,
+		useBinary:         db.useBinary,
+		Publications:      db.Publications,
+		ConfigFile:        db.ConfigFile,
+		HeartbeatTable:    db.HeartbeatTable,
+		HeartbeatInterval: db.HeartbeatInterval,
+		ExternalVersion:   db.ExternalVersion,
+		SlotMonitor:       db.SlotMonitor,
+		stream:            db.stream,
+		logger:            db.logger,
+		parent:            db,
+	}
+}
+
+// startBackfill copies existing rows of given tables (`schema.table`), while streaming goes on.
+// Documents never overwrite ones, which are already indexed by streaming: they are created, or versioned by LSN of COPY start.
+func (db *Database) startBackfill(ctx context.Context, tables []string) {
+	if !db.Backfill || len(tables) == 0 {
+		return
+	}
+	db.backfills.Add(1)
+	go func() {
+		defer db.backfills.Done()
+		if err := db.backfill(ctx, tables); err != nil {
+			db.logger.Error("backfill failed; run reindex to index existing rows", zap.Strings("tables", tables), zap.Error(err))
+		}
+	}()
+}
+
+func (db *Database) backfill(ctx context.Context, tables []string) error {
+	config, err := pgconnConfig()
+	if err != nil {
+		return err
+	}
+	config.RuntimeParams["application_name"] = defaultApplicationName
+	config.RuntimeParams["options"] = "-c statement_timeout=0"
+	delete(config.RuntimeParams, "replication")
+	conn, err := pgconn.ConnectConfig(ctx, config)
+	if err != nil {
+		return fmt.Errorf("can not connect: %w", err)
+	}
+	defer conn.Close(context.Background())
+
+	fork := db.fork(conn)
+	fork.backfilling = true
+	if err := fork.Discover(ctx); err != nil {
+		return err
+	}
+
+	for _, name := range tables {
+		parts := strings.SplitN(name, ".", 2)
+		schema, ok := fork.schemas[parts[0]]
+		if !ok || len(parts) != 2 {
+			continue
+		}
+		t, ok := schema.tables[parts[1]]
+		if !ok || !(t.index || len(t.isInlinedIn) > 0) {
+			continue // not published (anymore), or not indexed
+		}
+
+		// Streamed updates of the table are sent as whole documents, until all copied rows are in stream.
+		// Otherwise partial update of a row, which is not copied yet, is lost, and COPY writes stale row.
+		db.copying.Store(name, true)
+
+		// COPY snapshot is taken after this position, so streamed changes of copied rows have greater version
+		lsn, err := fork.queryValue(ctx, `SELECT pg_current_wal_lsn()`)
+		if err != nil {
+			db.copying.Delete(name)
+			return err
+		}
+		if fork.snapshotLSN, err = pglogrepl.ParseLSN(lsn); err != nil {
+			db.copying.Delete(name)
+			return fmt.Errorf("parse LSN %q: %w", lsn, err)
+		}
+
+		t.logger.Info("backfill started", zap.Stringer("lsn", fork.snapshotLSN))
+		err = t.CopyAll(ctx, conn)
+		db.copying.Delete(name)
+		if err != nil {
+			metricBackfills.WithLabelValues(t.name, "failed").Inc()
+			return fmt.Errorf("backfill %s: %w", name, err)
+		}
+		metricBackfills.WithLabelValues(t.name, "done").Inc()
+		t.logger.Info("backfill finished")
+	}
+	return nil
+}
+
+// isCopying reports whether rows of the table are being copied by backfill, thus its documents might not exist yet.
+func (db *Database) isCopying(t *Table) bool {
+	_, ok := db.copying.Load(t.schema.name + "." + t.name)
+	return ok
+}
+
+// publishedTables returns sorted list of published tables
+func (db *Database) publishedTables(ctx context.Context) ([]string, error) {
+	db.queryConnMu.Lock()
+	res := db.queryConn.ExecParams(ctx, publishedTablesQuery, [][]byte{db.publicationsParam()}, nil, nil, nil).Read()
+	db.queryConnMu.Unlock()
+	if res.Err != nil {
+		return nil, fmt.Errorf("list published tables: %w", res.Err)
+	}
+	tables := make([]string, 0, len(res.Rows))
+	for _, row := range res.Rows {
+		tables = append(tables, string(row[0]))
+	}
+	sort.Strings(tables)
+	return tables, nil
+}
+
+// WatchPublication periodically checks the list of published tables, and reloads config once it's changed.
+// So tables, added to publication, are discovered (and backfilled) even if they have no changes yet.
+// Blocks until context is canceled.
+func (db *Database) WatchPublication(ctx context.Context) {
+	if db.PublicationCheckInterval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(db.PublicationCheckInterval)
+	defer ticker.Stop()
+
+	var known string
+	for checked := false; ; {
+		tables, err := db.publishedTables(ctx)
+		switch {
+		case err != nil:
+			db.logger.Warn("publication check failed", zap.Error(err))
+		case !checked:
+			known, checked = strings.Join(tables, ","), true
+		case known != strings.Join(tables, ","):
+			known = strings.Join(tables, ",")
+			db.logger.Info("published tables changed", zap.Strings("publications", db.Publications))
+			select {
+			case <-db.RequestReload(): // logged by reload
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
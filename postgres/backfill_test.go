@@ -0,0 +1,112 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/jackc/pglogrepl"
+	"github.com/jackc/pgtype"
+	"go.uber.org/zap"
+)
+
+// streamedTable sets up relation 10 `public.orders` with text columns (in attnum order), as announced by replication.
+// Old values of identity columns are sent in WAL.
+func streamedTable(ctx context.Context, t *testing.T, tag string, identity []string, columns ...string) *Database {
+	t.Helper()
+	db := New(NewStreamPipe(ctx), zap.NewNop())
+	table := db.schema("public").table("orders")
+	if err := table.parseStructTag(tag); err != nil {
+		t.Fatalf("parseStructTag() error = %v", err)
+	}
+	relation := &pglogrepl.RelationMessage{RelationID: 10, Namespace: "public", RelationName: "orders"}
+	for _, name := range columns {
+		table.Column(name)
+		relation.Columns = append(relation.Columns, &pglogrepl.RelationMessageColumn{Name: name, DataType: pgtype.TextOID})
+	}
+	for _, name := range identity {
+		table.Column(name).oldInWAL = true
+	}
+	if err := db.HandleLogical(ctx, 1, relation); err != nil {
+		t.Fatalf("HandleLogical(relation) error = %v", err)
+	}
+	return db
+}
+
+// streamedDocs handles messages of single transaction, and returns streamed documents.
+func streamedDocs(ctx context.Context, t *testing.T, db *Database, finalLSN pglogrepl.LSN, msgs ...pglogrepl.Message) []Document {
+	t.Helper()
+	docs := make(chan []Document, 1)
+	go func() {
+		var streamed []Document
+		for {
+			doc, err := db.stream.Next(ctx)
+			if _, commit := doc.(Position); err != nil || commit {
+				docs <- streamed
+				return
+			}
+			streamed = append(streamed, doc.(Document))
+		}
+	}()
+	msgs = append([]pglogrepl.Message{&pglogrepl.BeginMessage{FinalLSN: finalLSN}}, msgs...)
+	msgs = append(msgs, &pglogrepl.CommitMessage{CommitLSN: finalLSN})
+	for _, msg := range msgs {
+		if err := db.HandleLogical(ctx, finalLSN, msg); err != nil {
+			t.Fatalf("HandleLogical(%T) error = %v", msg, err)
+		}
+	}
+	return <-docs
+}
+
+// bulkAction returns action of bulk header, and its parameters
+func bulkAction(t *testing.T, doc Document) (ESAction, map[string]interface{}) {
+	t.Helper()
+	var header map[ESAction]map[string]interface{}
+	if err := json.Unmarshal(doc.Meta, &header); err != nil {
+		t.Fatalf("unmarshal header: %v", err)
+	}
+	for action, params := range header {
+		return action, params
+	}
+	return "", nil
+}
+
+// textTuple encodes values as text; `nil` is unchanged TOAST value
+func textTuple(values ...interface{}) *pglogrepl.TupleData {
+	tuple := &pglogrepl.TupleData{}
+	for _, v := range values {
+		col := &pglogrepl.TupleDataColumn{DataType: pglogrepl.TupleDataTypeToast}
+		if s, ok := v.(string); ok {
+			col = &pglogrepl.TupleDataColumn{DataType: pglogrepl.TupleDataTypeText, Data: []byte(s)}
+		}
+		tuple.Columns = append(tuple.Columns, col)
+	}
+	return tuple
+}
+
+func TestBackfillStreamsWholeDocuments(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	db := streamedTable(ctx, t, `pk:"id"`, []string{"id"}, "id", "status")
+	db.ExternalVersion = true
+	update := &pglogrepl.UpdateMessage{RelationID: 10, NewTuple: textTuple("1", "paid")}
+
+	// row is updated after COPY snapshot (LSN 100), but before copied row is written
+	db.copying.Store("public.orders", true)
+	docs := streamedDocs(ctx, t, db, 200, update)
+	if len(docs) != 1 {
+		t.Fatalf("update while copying streamed %d documents, want 1", len(docs))
+	}
+	if action, params := bulkAction(t, docs[0]); action != ESIndex || params["version"] != float64(200) { // newer than copied row
+		t.Errorf("update while copying = %s %v, want whole document of version 200", action, params)
+	}
+
+	db.copying.Delete("public.orders")
+	docs = streamedDocs(ctx, t, db, 300, update)
+	if len(docs) != 1 {
+		t.Fatalf("update after copy streamed %d documents, want 1", len(docs))
+	}
+	if action, _ := bulkAction(t, docs[0]); action != ESUpdate {
+		t.Errorf("update after copy = %s, want partial update", action)
+	}
+}
@@ -18,25 +18,32 @@ type Column struct {
 	sqlPK     bool   // in case if no config was provided, fallback to Postgres table primary key will be used
 	index     bool   // specifies whether column should be indexed or ignored
 	oldInWAL  bool   // old value is stored in WAL for delete/update operations. See: https://www.postgresql.org/docs/10/sql-altertable.html#SQL-CREATETABLE-REPLICA-IDENTITY
+	tag       string // effective conftags: comment merged with config file
 
 	// Postgres
+	num      int              // attnum; column order within table
 	pos      int              // column position in LogicalReplication messages or `COPY TO ... ` query result, during cold start
 	connInfo *pgtype.ConnInfo // same pointer as in database.connInfo
 
 	value     DecoderValue // TODO: decouple state from column
-	valueOmit bool         // TODO: merge with value
+	valueOmit bool         // value is unknown: unchanged TOAST, or not in WAL. TODO: merge with value
+	valueNull bool         // value is NULL
 
 	logger *zap.Logger
 }
 
 func (col *Column) decode(data []byte, dataType uint8) (err error) {
 	col.valueOmit = false
+	col.valueNull = false
 	switch dataType {
 	case pglogrepl.TupleDataTypeBinary:
 		err = col.value.DecodeBinary(col.connInfo, data)
+		col.valueNull = data == nil // COPY BINARY represents NULL as nil
 	case pglogrepl.TupleDataTypeText:
 		err = col.value.DecodeText(col.connInfo, data)
-	case pglogrepl.TupleDataTypeNull, pglogrepl.TupleDataTypeToast:
+	case pglogrepl.TupleDataTypeNull:
+		col.valueNull = true
+	case pglogrepl.TupleDataTypeToast: // unchanged TOAST value is not sent
 		col.valueOmit = true
 	default:
 		col.valueOmit = true
@@ -50,11 +57,20 @@ func (col *Column) decode(data []byte, dataType uint8) (err error) {
 	return nil
 }
 
+// Omit tells that value is unknown (unchanged TOAST), and should not be written into document.
 func (col *Column) Omit() bool {
 	return col.valueOmit
 }
 
+// Null tells that value is NULL
+func (col *Column) Null() bool {
+	return col.valueNull
+}
+
 func (col *Column) MarshalJSON() ([]byte, error) {
+	if col.valueNull {
+		return []byte("null"), nil
+	}
 	// reuse predefined MarshalJSON methods on Postgres types, to preserve null values, skip zeroing, and possible speedup
 	if marshaller, ok := col.value.(json.Marshaler); ok {
 		val, err := marshaller.MarshalJSON()
@@ -97,7 +113,7 @@ type DecoderValue interface {
 }
 
 func (col *Column) string() string {
-	if col.value.Get() == nil {
+	if col.valueNull || col.value.Get() == nil {
 		return ""
 	}
 	return fmt.Sprint(col.value.Get())
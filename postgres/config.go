@@ -5,10 +5,12 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/jackc/pgconn"
+	"github.com/jackc/pglogrepl"
 	"github.com/jackc/pgtype"
 	"go.uber.org/zap"
 )
@@ -28,6 +30,7 @@ func New(stream *StreamPipe, logger *zap.Logger) *Database {
 		logger:         logger,
 		stream:         stream,
 		connInfo:       pgtype.NewConnInfo(),
+		reloads:        make(chan reloadRequest, 8),
 	}
 }
 
@@ -40,15 +43,48 @@ type Database struct {
 	queryConn   *pgconn.PgConn // config and types discovery
 	queryConnMu sync.Mutex     // pgconn.PgConn is not thread safe.
 
-	connInfo       *pgtype.ConnInfo
-	version        string
-	SlotName       string
-	useBinary      bool
-	Publication    string
+	connInfo     *pgtype.ConnInfo
+	version      string
+	major        int // major Postgres version
+	SlotName     string
+	useBinary    bool
+	streaming    bool // replConn is in streaming mode
+	Publications []string
+	// ConfigFile (optional) YAML or JSON alternative to comments. See FileConfig.
+	ConfigFile     string
+	fileConfig     *FileConfig
 	StandbyTimeout time.Duration
 
-	stream *StreamPipe
-	logger *zap.Logger
+	// HeartbeatInterval enables periodical writes into WAL, to advance slot position when published tables are idle.
+	HeartbeatInterval time.Duration
+	// HeartbeatTable (optional) is updated on each heartbeat. Otherwise logical message is emitted.
+	HeartbeatTable string
+
+	// ExternalVersion makes index and delete operations idempotent: commit LSN is used as external document version,
+	// so replayed or retried stale operations do not overwrite newer documents.
+	ExternalVersion bool
+	snapshotLSN     pglogrepl.LSN // consistent point of created slot; version of reindexed documents
+
+	// SlotMonitor configures slot health checks. See MonitorSlot.
+	SlotMonitor SlotMonitorOpts
+	slotMonitor slotMonitor
+
+	// Backfill copies existing rows of tables, which are added to publication at runtime.
+	Backfill bool
+	// PublicationCheckInterval how often published tables are checked. See WatchPublication.
+	PublicationCheckInterval time.Duration
+	backfills                sync.WaitGroup
+	backfilling              bool      // forked for backfill; documents are created only
+	copying                  sync.Map  // tables (`schema.table`), which are copied by backfill right now
+	parent                   *Database // of fork
+
+	tx      transaction        // current transaction; set by BeginMessage
+	inTx    bool               // between BeginMessage and CommitMessage
+	reloads chan reloadRequest // pending config reloads; applied between transactions
+
+	stream       *StreamPipe
+	knownIndices sync.Map // time based indices, which were already announced by CreateIndex
+	logger       *zap.Logger
 }
 
 // indexableTables returns filtered list of tables, that's are subject to be indexed
@@ -124,6 +160,21 @@ func (db *Database) relation(oid uint32) (tc *Table) {
 	return nil
 }
 
+// changedRelation returns table of row change, or nil if change is ignored: relation is unknown, or removed from publication.
+func (db *Database) changedRelation(oid uint32, operation string) *Table {
+	table := db.relation(oid)
+	switch {
+	case table == nil:
+		metricIgnoredMessages.WithLabelValues(operation, "").Inc()
+		db.logger.Warn("change of unknown relation is ignored", zap.Uint32("relation_id", oid), zap.String("operation", operation))
+		return nil
+	case table.removed:
+		table.ignore(operation)
+		return nil
+	}
+	return table
+}
+
 // schema returns (and creates if required) initialized schema config
 func (db *Database) schema(name string) (sc *Schema) {
 	if _, exists := db.schemas[name]; !exists {
@@ -159,10 +210,16 @@ func (sc *Schema) table(name string) (tc *Table) {
 			schema:  sc,
 			name:    name,
 			docType: name, // default
+			pkSep:   defaultKeySeparator,
 			columns: make(map[string]*Column),
 			index:   true, // index all by default. Since it's already specified in publication
 			logger:  sc.database.logger.With(zap.String("table", name)),
 		}
+		if sc.database.isHeartbeatTable(sc.name, name) {
+			sc.tables[name].heartbeat = true
+			sc.tables[name].index = false
+			sc.tables[name].tagParsed = true // ignore any configuration
+		}
 	}
 
 	return sc.tables[name]
@@ -175,6 +232,7 @@ func (sc *Schema) inline(name string) (inl *Inline) {
 			name:        name,
 			fieldName:   name,
 			columns:     make(map[string]*Column),
+			parentRefs:  make(map[string]string),
 			scriptAddID: "inline_add",
 			scriptDelID: "inline_del",
 			logger:      sc.database.logger.With(zap.String("inline", name)),
@@ -184,6 +242,18 @@ func (sc *Schema) inline(name string) (inl *Inline) {
 	return sc.inlines[name]
 }
 
+// Init checks config of discovered tables, and prepares them for indexing
+func (db *Database) Init() error {
+	for _, schema := range db.schemas {
+		for _, table := range schema.tables {
+			if err := table.init(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 // PrintStatus prints some debug information
 // TODO: remove
 func (db *Database) PrintSatus() {
@@ -191,8 +261,11 @@ func (db *Database) PrintSatus() {
 	for _, schema := range db.schemas {
 		log.Print(schema.name)
 		for _, table := range schema.tables {
-			table.init()
-			log.Printf(" - %s\n", table.name)
+			if table.index {
+				log.Printf(" - %s -> %s\n", table.name, table.targetName())
+			} else {
+				log.Printf(" - %s\n", table.name)
+			}
 			if table.upsertOnly {
 				log.Print("   WARNING: Table is forwarded in upsert only mode. Not all key fields are awailable in WAL")
 			}
@@ -207,7 +280,7 @@ func (db *Database) PrintSatus() {
 				if column.name != column.fieldName {
 					cdesc += " -> " + column.fieldName
 				}
-				if column == column.table.pkCol { // same pointer
+				if column.table.pkCols.contains(column) { // same pointer
 					cdesc += " PK"
 				}
 				if column == column.table.routingCol { // same pointer
@@ -223,8 +296,8 @@ func (db *Database) PrintSatus() {
 					"   @ %s.%s\t%s\t[%s.%s == %s.%s]\n",
 					inline.parent.name, inline.fieldName,
 					inline.name,
-					inline.source.name, inline.parentCol.name,
-					inline.parent.name, inline.parent.pkCol.name,
+					inline.source.name, strings.Join(inline.parentCols.names(), ","),
+					inline.parent.name, strings.Join(inline.parent.pkCols.names(), ","),
 				)
 			}
 		}
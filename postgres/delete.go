@@ -0,0 +1,94 @@
+package postgres
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	jwriter "github.com/mailru/easyjson/jwriter"
+)
+
+// Delete strategies. E.G: `delete:"soft,is_deleted,removed_at"`
+const (
+	DeleteHard   = "hard"   // delete document or inlined object
+	DeleteSoft   = "soft"   // keep document, but mark it deleted
+	DeleteIgnore = "ignore" // keep document as is
+)
+
+const (
+	defaultDeletedField   = "deleted"
+	defaultDeletedAtField = "deleted_at"
+	inlineSoftDelScriptID = "inline_soft_del"
+)
+
+// deleteStrategy defines how deleted rows are reflected in search index
+type deleteStrategy struct {
+	mode         string
+	deletedField string // boolean flag; soft mode only
+	timeField    string // commit time of deleting transaction; soft mode only
+}
+
+// parseDeleteStrategy parses `delete` tag values: mode, and optional field names for soft mode.
+func parseDeleteStrategy(values []string) (deleteStrategy, error) {
+	ds := deleteStrategy{
+		mode:         values[0],
+		deletedField: defaultDeletedField,
+		timeField:    defaultDeletedAtField,
+	}
+	switch ds.mode {
+	case "":
+		ds.mode = DeleteHard
+	case DeleteHard, DeleteSoft, DeleteIgnore:
+	default:
+		return ds, fmt.Errorf("unknown delete strategy %q", ds.mode)
+	}
+	if len(values) > 1 && values[1] != "" {
+		ds.deletedField = values[1]
+	}
+	if len(values) > 2 && values[2] != "" {
+		ds.timeField = values[2]
+	}
+	return ds, nil
+}
+
+// encodeFields writes soft delete marker `{"deleted":true,"deleted_at":"..."}`
+func (ds deleteStrategy) encodeFields(out *jwriter.Writer, deletedAt time.Time) {
+	out.RawByte('{')
+	out.String(ds.deletedField)
+	out.RawString(`:true,`)
+	out.String(ds.timeField)
+	out.RawByte(':')
+	out.String(deletedAt.UTC().Format(time.RFC3339Nano))
+	out.RawByte('}')
+}
+
+// EncodeSoftDeleteJSON is a partial document update, which marks document as deleted
+func (t *Table) EncodeSoftDeleteJSON() ([]byte, error) {
+	out := jwriter.Writer{}
+	out.RawString(`{"doc":`)
+	t.delete.encodeFields(&out, t.schema.database.tx.commitTime)
+	out.RawByte('}')
+	return out.Buffer.BuildBytes(), out.Error
+}
+
+// jsonSoftDelScript marks inlined object as deleted, keeping the rest of its fields.
+func (inline *Inline) jsonSoftDelScript() ([]byte, error) {
+	out := jwriter.Writer{}
+	out.RawString(`{"script":{"id":`)
+	out.String(inlineSoftDelScriptID)
+	out.RawString(`,"params":{"obj":`)
+
+	inline.jsonEncodeRow(&out)
+
+	out.RawString(`,"pk":`)
+	out.Raw(json.Marshal(inline.pkFields()))
+	out.RawString(`,"inline":`)
+	out.String(inline.fieldName)
+	out.RawString(`,"fields":`)
+	inline.source.delete.encodeFields(&out, inline.source.schema.database.tx.commitTime)
+	out.RawString(`}`)
+
+	out.RawString(`},"scripted_upsert":false}`)
+
+	return out.Buffer.BuildBytes(), out.Error
+}
@@ -20,9 +20,6 @@ var (
 	ErrUnknownType = errors.New("unknown type")
 )
 
-// TODO: check `wal_status` from `pg_replication_slots`. See: https://www.postgresql.org/docs/13/view-pg-replication-slots.html
-// And if status is `lost`, start reindexing from scratch.
-
 // discoverQuery selects all table and column comments for tables mentioned in publication.
 // comments are used as golang structtags for configuration.
 // TODO (vitalii): check if FK -> tablename can help with inlines
@@ -33,11 +30,34 @@ var discoverQuery string
 // Discover uses Postgres publication and table or column comments to generate replication config
 // Only tables explosed via Publication will be considered for exporting to ES.
 func (db *Database) Discover(ctx context.Context) error {
+	return db.discover(ctx, nil, nil)
+}
+
+// DiscoverTable discovers single table. Config of already known columns is kept, while new columns are configured from comments.
+func (db *Database) DiscoverTable(ctx context.Context, schema, table string) error {
+	return db.discover(ctx, []byte(schema), []byte(table))
+}
+
+// discover optionally limited to schema and table (nil means any)
+func (db *Database) discover(ctx context.Context, schema, table []byte) error {
+	if db.ConfigFile != "" && schema == nil && table == nil { // re-read on full discovery, E.G: reload
+		cfg, err := LoadFileConfig(db.ConfigFile)
+		if err != nil {
+			return err
+		}
+		db.fileConfig = cfg
+	}
+
+	published, err := db.discoverPublications(ctx, schema, table)
+	if err != nil {
+		return err
+	}
+
 	db.queryConnMu.Lock()
 	res := db.queryConn.ExecParams(
 		ctx, discoverQuery,
-		[][]byte{[]byte(db.Publication)}, nil, nil,
-		[]int16{binT, binT, binT, binT, binT, binT, binT, binT},
+		[][]byte{db.publicationsParam(), schema, table}, nil, nil,
+		[]int16{binT, binT, binT, binT, binT, binT, binT, binT, binT, binT, binT},
 	).Read()
 	db.queryConnMu.Unlock()
 
@@ -54,8 +74,13 @@ func (db *Database) Discover(ctx context.Context) error {
 		ColumnComment pgtype.Text
 		Typ           pgtype.OID
 		OldInWAL      pgtype.Bool
+		Num           pgtype.Int2
+		RootTable     pgtype.Text
+		Partitioned   pgtype.Bool
 	}{}
 
+	discovered := make(map[*Table]bool)
+	var configErr error // first one; the rest of config is still discovered
 	for _, row := range res.Rows {
 		cd.Schema.DecodeBinary(nil, row[0])
 		cd.Table.DecodeBinary(nil, row[1])
@@ -65,11 +90,50 @@ func (db *Database) Discover(ctx context.Context) error {
 		cd.PK.DecodeBinary(nil, row[5])
 		cd.Typ.DecodeBinary(nil, row[6])
 		cd.OldInWAL.DecodeBinary(nil, row[7])
+		cd.Num.DecodeBinary(nil, row[8])
+		cd.RootTable.DecodeBinary(nil, row[9])
+		cd.Partitioned.DecodeBinary(nil, row[10])
 
 		t := db.schema(cd.Schema.String).table(cd.Table.String)
-		t.parseStructTag(cd.TableComment.String) // table config needs to be parsed before column config, since some values are inherited from it
+		t.partitioned = cd.Partitioned.Bool
+		if cd.RootTable.Status == pgtype.Present && t.partitionOf == "" { // before parsing tags, since defaults are taken from root
+			t.setPartitionOf(cd.RootTable.String)
+		}
+		// table config needs to be parsed before column config, since some values are inherited from it
+		if !t.tagParsed {
+			t.tag = db.tableTag(cd.Schema.String, t.configName(), cd.TableComment.String)
+		}
+		if err := t.parseStructTag(t.tag); err != nil {
+			t.logger.Error("can not parse table config; table is not indexed", zap.Error(err))
+			t.index = false
+			if configErr == nil {
+				configErr = t.configError("%v", err)
+			}
+		}
+		discovered[t] = true
+		t.publication = published[cd.Schema.String+"."+cd.Table.String]
+		if !t.publication.published(cd.Column.String) { // not sent in WAL
+			if t.unpublished == nil {
+				t.unpublished = make(map[string]bool)
+			}
+			t.unpublished[cd.Column.String] = true
+			if db.columnTag(cd.Schema.String, t.configName(), cd.Column.String, cd.ColumnComment.String) != "" {
+				t.logger.Warn("column config is ignored; column is not published", zap.String("column", cd.Column.String))
+			}
+			continue
+		}
+		_, known := t.columns[cd.Column.String]
 		col := t.Column(cd.Column.String)
-		col.parseStructTag(cd.ColumnComment.String)
+		col.num = int(cd.Num.Int) // before parsing tags, since composite keys are ordered by it
+		if !known {               // config of known columns is parsed already
+			col.tag = db.columnTag(cd.Schema.String, t.configName(), cd.Column.String, cd.ColumnComment.String)
+			if err := col.parseStructTag(col.tag); err != nil {
+				t.logger.Error("can not parse column config", zap.Error(err))
+				if configErr == nil {
+					configErr = t.configError("%v", err)
+				}
+			}
+		}
 		col.sqlPK = cd.PK.Bool
 		col.oldInWAL = cd.OldInWAL.Bool
 
@@ -80,7 +144,10 @@ func (db *Database) Discover(ctx context.Context) error {
 		col.setTyp(dataType)
 		// col.logger.Debug("discovered column", zap.String("name", col.name), zap.String("field", col.fieldName))
 	}
-	return nil
+	for t := range discovered {
+		t.checkPublication()
+	}
+	return configErr
 }
 
 // discoverENUMQuery can be used to retrieve enum members, which is not required. But gives slightly increased performance.
@@ -97,7 +164,7 @@ func (db *Database) discoverUnknownType(ctx context.Context, oid pgtype.OID) err
 
 	typInfo, err := db.getTypInfo(ctx, oid)
 	if err != nil {
-		return fmt.Errorf("get type info", err)
+		return fmt.Errorf("get type info: %w", err)
 	}
 
 	switch typInfo.Typ.Int {
@@ -0,0 +1,242 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/jackc/pgtype"
+)
+
+// Problem of database setup, found by Doctor. SQL (if any) fixes it.
+type Problem struct {
+	Table string // optional
+	Issue string
+	SQL   string
+}
+
+func (p Problem) String() string {
+	if p.Table == "" {
+		return p.Issue
+	}
+	return p.Table + ": " + p.Issue
+}
+
+// DoctorOpts configures Doctor checks
+type DoctorOpts struct {
+	// PublishTables are included into created publication. All tables by default.
+	PublishTables []string
+}
+
+// uniqueIndicesQuery selects indices, which can be used as replica identity: unique, immediate, not partial, without expressions, with NOT NULL columns.
+// Only key columns are selected; INCLUDE columns are not part of replica identity (indkey is zero based int2vector).
+const uniqueIndicesQuery = `SELECT ic.relname, array_agg(a.attname::text ORDER BY a.attnum)
+FROM pg_index AS i
+	INNER JOIN pg_class AS ic ON ic.oid = i.indexrelid
+	INNER JOIN pg_attribute AS a ON a.attrelid = i.indrelid AND a.attnum = ANY(i.indkey[:i.indnkeyatts-1])
+WHERE i.indrelid = $1::regclass AND i.indisunique AND i.indimmediate AND i.indpred IS NULL AND i.indexprs IS NULL
+GROUP BY ic.relname
+HAVING bool_and(a.attnotnull)
+ORDER BY count(*), ic.relname`
+
+// Doctor checks, whether database is set up for replication: wal_level, publications, replica identity of tables and replication slot.
+// Config is discovered, so tables should be checked after publications are created.
+func (db *Database) Doctor(ctx context.Context, opts DoctorOpts) ([]Problem, error) {
+	var problems []Problem
+
+	walLevel, err := db.queryValue(ctx, `SHOW wal_level`)
+	if err != nil {
+		return nil, err
+	}
+	if walLevel != "logical" {
+		problems = append(problems, Problem{
+			Issue: fmt.Sprintf("wal_level is %q; logical is required, and server has to be restarted", walLevel),
+			SQL:   `ALTER SYSTEM SET wal_level = logical`,
+		})
+	}
+
+	missing, err := db.missingPublications(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range missing {
+		target := "ALL TABLES"
+		if len(opts.PublishTables) > 0 {
+			tables := make([]string, len(opts.PublishTables))
+			for i, table := range opts.PublishTables {
+				tables[i] = quoteQualified(table)
+			}
+			target = "TABLE " + strings.Join(tables, ", ")
+		}
+		problems = append(problems, Problem{
+			Issue: fmt.Sprintf("publication %q does not exist", name),
+			SQL:   "CREATE PUBLICATION " + quoteIdent(name) + " FOR " + target,
+		})
+	}
+
+	if err := db.Discover(ctx); errors.Is(err, ErrInvalidConfig) { // table with unparsable config is not indexed, so not checked below
+		problems = append(problems, Problem{Issue: err.Error()})
+	} else if err != nil {
+		return nil, err
+	}
+	for _, table := range db.indexableTables() {
+		if err := table.init(); err != nil {
+			problems = append(problems, Problem{Issue: err.Error()}) // names table or inline
+			continue
+		}
+		p, err := db.checkReplicaIdentity(ctx, table)
+		if err != nil {
+			return nil, err
+		}
+		if p != nil {
+			problems = append(problems, *p)
+		}
+	}
+
+	if _, err := db.SlotStatus(ctx); errors.Is(err, ErrSlotNotFound) {
+		problems = append(problems, Problem{
+			Issue: fmt.Sprintf("replication slot %q does not exist", db.SlotName),
+			SQL:   fmt.Sprintf("SELECT pg_create_logical_replication_slot('%s', '%s')", strings.ReplaceAll(db.SlotName, "'", "''"), outputPlugin),
+		})
+	} else if err != nil {
+		return nil, err
+	}
+	return problems, nil
+}
+
+// Fix applies SQL of the problem
+func (db *Database) Fix(ctx context.Context, p Problem) error {
+	if p.SQL == "" {
+		return nil
+	}
+	db.queryConnMu.Lock()
+	_, err := db.queryConn.Exec(ctx, p.SQL).ReadAll()
+	db.queryConnMu.Unlock()
+	if err != nil {
+		return fmt.Errorf("fix %s: %w", p, err)
+	}
+	return nil
+}
+
+// identityColumns returns columns, which old values are required in WAL for update and delete, with purposes.
+func (t *Table) identityColumns() map[*Column][]string {
+	need := make(map[*Column][]string)
+	add := func(purpose string, cols ...*Column) {
+		for _, col := range cols {
+			if col != nil {
+				need[col] = append(need[col], purpose)
+			}
+		}
+	}
+	if t.index && !t.appendOnly {
+		if t.idTmpl == nil && !t.autoID {
+			add("_id", t.pkCols...)
+		}
+		add("routing", t.routingCol)
+		for _, rt := range t.templates() {
+			add(rt.tmpl.Name(), rt.columns...)
+		}
+		if t.partition != nil {
+			add("partition", t.partition.col)
+		}
+	}
+	for _, inl := range t.isInlinedIn {
+		add("inline "+inl.name+" parent", inl.parentCols...)
+		add("inline "+inl.name+" pk", inl.pkCols...)
+		add("inline "+inl.name+" routing", inl.routingCol)
+	}
+	return need
+}
+
+// checkReplicaIdentity reports columns, which are required, but not sent in WAL.
+// Smallest suitable unique index is suggested as replica identity, otherwise FULL.
+func (db *Database) checkReplicaIdentity(ctx context.Context, t *Table) (*Problem, error) {
+	var missing []string
+	required := make(map[string]bool)
+	for col, purposes := range t.identityColumns() {
+		required[col.name] = true
+		if !col.oldInWAL {
+			missing = append(missing, col.name+" ("+strings.Join(purposes, ", ")+")")
+		}
+	}
+	if len(missing) == 0 {
+		return nil, nil
+	}
+	sort.Strings(missing)
+
+	table := quoteIdent(t.schema.name) + "." + quoteIdent(t.name)
+	db.queryConnMu.Lock()
+	res := db.queryConn.ExecParams(ctx, uniqueIndicesQuery, [][]byte{[]byte(table)}, nil, nil, nil).Read()
+	db.queryConnMu.Unlock()
+	if res.Err != nil {
+		return nil, fmt.Errorf("find unique indices of %s: %w", table, res.Err)
+	}
+
+	identity := "FULL"
+	for _, row := range res.Rows {
+		var columns pgtype.TextArray
+		if err := columns.DecodeText(db.connInfo, row[1]); err != nil {
+			return nil, fmt.Errorf("decode index columns: %w", err)
+		}
+		covered := 0
+		for _, name := range columns.Elements {
+			if required[name.String] {
+				covered++
+			}
+		}
+		if covered == len(required) {
+			identity = "USING INDEX " + quoteIdent(string(row[0]))
+			break
+		}
+	}
+	return &Problem{
+		Table: t.schema.name + "." + t.name,
+		Issue: "columns are not in replica identity: " + strings.Join(missing, "; "),
+		SQL:   "ALTER TABLE " + table + " REPLICA IDENTITY " + identity,
+	}, nil
+}
+
+// missingPublications returns configured publications, which do not exist
+func (db *Database) missingPublications(ctx context.Context) ([]string, error) {
+	db.queryConnMu.Lock()
+	res := db.queryConn.ExecParams(ctx, `SELECT pubname FROM pg_publication WHERE pubname = ANY($1::text[])`, [][]byte{db.publicationsParam()}, nil, nil, nil).Read()
+	db.queryConnMu.Unlock()
+	if res.Err != nil {
+		return nil, fmt.Errorf("list publications: %w", res.Err)
+	}
+	exists := make(map[string]bool, len(res.Rows))
+	for _, row := range res.Rows {
+		exists[string(row[0])] = true
+	}
+	var missing []string
+	for _, name := range db.Publications {
+		if !exists[name] {
+			missing = append(missing, name)
+		}
+	}
+	return missing, nil
+}
+
+// queryValue returns the first value of a simple query
+func (db *Database) queryValue(ctx context.Context, sql string) (string, error) {
+	db.queryConnMu.Lock()
+	res := db.queryConn.ExecParams(ctx, sql, nil, nil, nil, nil).Read()
+	db.queryConnMu.Unlock()
+	if res.Err != nil {
+		return "", fmt.Errorf("%s: %w", sql, res.Err)
+	}
+	if len(res.Rows) == 0 || len(res.Rows[0]) == 0 {
+		return "", fmt.Errorf("%s: no rows", sql)
+	}
+	return string(res.Rows[0][0]), nil
+}
+
+// quoteQualified quotes `schema.table` or `table` name
+func quoteQualified(name string) string {
+	if parts := strings.SplitN(name, ".", 2); len(parts) == 2 {
+		return quoteIdent(parts[0]) + "." + quoteIdent(parts[1])
+	}
+	return quoteIdent(name)
+}
@@ -0,0 +1,287 @@
+package postgres
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/pg2es/search-replica/conftags"
+)
+
+// Config file modes
+const (
+	ModeMerge    = "merge"    // file tags take precedence over the same tags in comments; other comment tags are kept
+	ModeOverride = "override" // comments are ignored
+)
+
+// ErrConfigFile invalid config file
+var ErrConfigFile = errors.New("invalid config file")
+
+// FileConfig is a declarative alternative to comments. YAML or JSON.
+// Tags have the same semantics as conftags in comments, E.G:
+//
+//	tables:
+//	  public.products:
+//	    tags: {index: product, inline: [[reviews, reviews]]}
+//	    columns:
+//	      price: {index: price_usd}
+type FileConfig struct {
+	Mode   string                  `yaml:"mode,omitempty" json:"mode,omitempty"`
+	Tables map[string]*TableConfig `yaml:"tables" json:"tables"` // by `schema.table`
+}
+
+// TableConfig describes tags of table, and its columns
+type TableConfig struct {
+	Tags    TagSet            `yaml:"tags,omitempty" json:"tags,omitempty"`
+	Columns map[string]TagSet `yaml:"columns,omitempty" json:"columns,omitempty"`
+}
+
+// TagSet is tag values by tag name.
+type TagSet map[string]TagValues
+
+// TagValues of repeated tags (E.G: multiple inlines), each with comma separated values.
+// Scalar `a,b`, list `[a, b]`, and list of lists `[[a, b]]` are accepted.
+type TagValues [][]string
+
+// UnmarshalYAML accepts scalar, list or list of lists
+func (v *TagValues) UnmarshalYAML(node *yaml.Node) error {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		*v = TagValues{{node.Value}}
+		return nil
+	case yaml.SequenceNode:
+		var values []string
+		if err := node.Decode(&values); err == nil {
+			*v = TagValues{values}
+			return nil
+		}
+		var repeated [][]string
+		if err := node.Decode(&repeated); err != nil {
+			return fmt.Errorf("line %d: list or list of lists expected: %w", node.Line, err)
+		}
+		*v = repeated
+		return nil
+	}
+	return fmt.Errorf("line %d: tag value should be scalar or list", node.Line)
+}
+
+// compact returns the shortest representation: scalar, list or list of lists
+func (v TagValues) compact() interface{} {
+	switch {
+	case len(v) == 1 && len(v[0]) == 1:
+		return v[0][0]
+	case len(v) == 1:
+		return v[0]
+	}
+	return [][]string(v)
+}
+
+// MarshalYAML uses the shortest representation
+func (v TagValues) MarshalYAML() (interface{}, error) {
+	return v.compact(), nil
+}
+
+// MarshalJSON uses the shortest representation
+func (v TagValues) MarshalJSON() ([]byte, error) {
+	return json.Marshal(v.compact())
+}
+
+// String formats tags in conftag syntax, sorted by name. E.G: `index:"product" inline:"reviews,reviews"`
+func (s TagSet) String() string {
+	names := make([]string, 0, len(s))
+	for name := range s {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var tags []string
+	for _, name := range names {
+		for _, values := range s[name] {
+			tags = append(tags, name+":"+strconv.Quote(strings.Join(values, ",")))
+		}
+	}
+	return strings.Join(tags, " ")
+}
+
+// parseTagSet parses conftag syntax
+func parseTagSet(src string) (TagSet, error) {
+	tags, err := conftags.Parse(src)
+	if err != nil || len(tags) == 0 {
+		return nil, err
+	}
+	s := make(TagSet, len(tags))
+	for _, tag := range tags {
+		s[tag.Name] = append(s[tag.Name], tag.Values)
+	}
+	return s, nil
+}
+
+// LoadFileConfig reads YAML or JSON config file
+func LoadFileConfig(path string) (*FileConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read config file: %w", err)
+	}
+	cfg := &FileConfig{}
+	if err := yaml.Unmarshal(data, cfg); err != nil { // JSON is valid YAML
+		return nil, fmt.Errorf("%w %s: %v", ErrConfigFile, path, err)
+	}
+	switch cfg.Mode {
+	case "":
+		cfg.Mode = ModeMerge
+	case ModeMerge, ModeOverride:
+	default:
+		return nil, fmt.Errorf("%w %s: unknown mode %q", ErrConfigFile, path, cfg.Mode)
+	}
+	for name, tc := range cfg.Tables {
+		if !strings.Contains(name, ".") {
+			return nil, fmt.Errorf("%w %s: table %q should be qualified by schema", ErrConfigFile, path, name)
+		}
+		if tc == nil {
+			continue
+		}
+		if tag := tc.Tags.unknown(tableTagNames); tag != "" {
+			return nil, fmt.Errorf("%w %s: table %s: unknown tag %q", ErrConfigFile, path, name, tag)
+		}
+		for column, tags := range tc.Columns {
+			if tag := tags.unknown(columnTagNames); tag != "" {
+				return nil, fmt.Errorf("%w %s: column %s.%s: unknown tag %q", ErrConfigFile, path, name, column, tag)
+			}
+		}
+	}
+	return cfg, nil
+}
+
+// unknown returns the first (sorted) tag name, which is not known
+func (s TagSet) unknown(known map[string]bool) string {
+	var names []string
+	for name := range s {
+		if !known[name] {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return ""
+	}
+	sort.Strings(names)
+	return names[0]
+}
+
+// mergeTags combines tags of file and comment, according to mode. File tags replace the same tags of comment, except repeated ones.
+func (cfg *FileConfig) mergeTags(file TagSet, comment string) string {
+	if cfg == nil {
+		return comment
+	}
+	if cfg.Mode == ModeOverride {
+		return file.String()
+	}
+	if len(file) == 0 {
+		return comment
+	}
+	commentTags, err := parseTagSet(comment)
+	if err != nil {
+		return file.String() + " " + comment // keep syntax error visible
+	}
+	merged := make(TagSet, len(file)+len(commentTags))
+	for name, values := range commentTags {
+		merged[name] = values
+	}
+	for name, values := range file {
+		if name == "inline" { // repeated tag: both sources are kept
+			merged[name] = append(append(TagValues{}, values...), commentTags[name]...)
+			continue
+		}
+		merged[name] = values
+	}
+	return merged.String()
+}
+
+// tableTag returns effective tags of table
+func (db *Database) tableTag(schema, table, comment string) string {
+	if db.fileConfig == nil {
+		return comment
+	}
+	var file TagSet
+	if tc := db.fileConfig.Tables[schema+"."+table]; tc != nil {
+		file = tc.Tags
+	}
+	return db.fileConfig.mergeTags(file, comment)
+}
+
+// columnTag returns effective tags of column
+func (db *Database) columnTag(schema, table, column, comment string) string {
+	if db.fileConfig == nil {
+		return comment
+	}
+	var file TagSet
+	if tc := db.fileConfig.Tables[schema+"."+table]; tc != nil {
+		file = tc.Columns[column]
+	}
+	return db.fileConfig.mergeTags(file, comment)
+}
+
+// ExportConfig returns effective config of discovered tables (comments merged with config file).
+// Partitions are exported once, as their root table.
+func (db *Database) ExportConfig() (*FileConfig, error) {
+	cfg := &FileConfig{Mode: ModeOverride, Tables: make(map[string]*TableConfig)}
+	for _, schema := range db.schemas {
+		for _, t := range schema.tables {
+			name := schema.name + "." + t.configName()
+			if _, ok := cfg.Tables[name]; ok || t.heartbeat {
+				continue
+			}
+			tags, err := parseTagSet(t.tag)
+			if err != nil {
+				return nil, fmt.Errorf("table %s: %w", name, err)
+			}
+			tc := &TableConfig{Tags: tags, Columns: make(map[string]TagSet)}
+			for _, col := range t.columns {
+				tags, err := parseTagSet(col.tag)
+				if err != nil {
+					return nil, fmt.Errorf("column %s.%s: %w", name, col.name, err)
+				}
+				if len(tags) > 0 {
+					tc.Columns[col.name] = tags
+				}
+			}
+			if len(tc.Tags) > 0 || len(tc.Columns) > 0 {
+				cfg.Tables[name] = tc
+			}
+		}
+	}
+	return cfg, nil
+}
+
+// Comments returns `COMMENT ON` statements, which configure the same as config file.
+func (cfg *FileConfig) Comments() []string {
+	names := make([]string, 0, len(cfg.Tables))
+	for name := range cfg.Tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	literal := func(s string) string { return "'" + strings.ReplaceAll(s, "'", "''") + "'" }
+	var statements []string
+	for _, name := range names {
+		tc := cfg.Tables[name]
+		table := quoteQualified(name)
+		if len(tc.Tags) > 0 {
+			statements = append(statements, "COMMENT ON TABLE "+table+" IS "+literal(tc.Tags.String()))
+		}
+		columns := make([]string, 0, len(tc.Columns))
+		for column := range tc.Columns {
+			columns = append(columns, column)
+		}
+		sort.Strings(columns)
+		for _, column := range columns {
+			statements = append(statements, "COMMENT ON COLUMN "+table+"."+quoteIdent(column)+" IS "+literal(tc.Columns[column].String()))
+		}
+	}
+	return statements
+}
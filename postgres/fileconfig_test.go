@@ -0,0 +1,110 @@
+package postgres
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadFileConfig(t *testing.T) {
+	src := `
+tables:
+  public.products:
+    tags:
+      index: product
+      pk: [tenant_id, id]
+      inline: [[reviews, reviews], [tags, tags]]
+    columns:
+      price: {index: price_usd}
+`
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(src), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := LoadFileConfig(path)
+	if err != nil {
+		t.Fatalf("LoadFileConfig() error = %v", err)
+	}
+	if cfg.Mode != ModeMerge {
+		t.Errorf("Mode = %q, want %q", cfg.Mode, ModeMerge)
+	}
+	tc := cfg.Tables["public.products"]
+	want := TagSet{
+		"index":  {{"product"}},
+		"pk":     {{"tenant_id", "id"}},
+		"inline": {{"reviews", "reviews"}, {"tags", "tags"}},
+	}
+	if !reflect.DeepEqual(tc.Tags, want) {
+		t.Errorf("Tags = %v, want %v", tc.Tags, want)
+	}
+	if got := tc.Tags.String(); got != `index:"product" inline:"reviews,reviews" inline:"tags,tags" pk:"tenant_id,id"` {
+		t.Errorf("Tags.String() = %s", got)
+	}
+	if got := tc.Columns["price"].String(); got != `index:"price_usd"` {
+		t.Errorf("column tags = %s", got)
+	}
+}
+
+func TestLoadFileConfigUnknownTag(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+	}{
+		{"table", "tables:\n  public.products:\n    tags: {docType: product}\n"},
+		{"column", "tables:\n  public.products:\n    columns:\n      price: {field: price_usd}\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(path, []byte(tt.src), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := LoadFileConfig(path); !errors.Is(err, ErrConfigFile) {
+				t.Errorf("LoadFileConfig() error = %v, want %v", err, ErrConfigFile)
+			}
+		})
+	}
+}
+
+func TestFileConfigMergeTags(t *testing.T) {
+	file := TagSet{"index": {{"product"}}, "inline": {{"reviews", "reviews"}}}
+	comment := `index:"item" pk:"id" inline:"tags,tags"`
+
+	tests := []struct {
+		name string
+		cfg  *FileConfig
+		file TagSet
+		want string
+	}{
+		{"no file", nil, file, comment},
+		{"merge", &FileConfig{Mode: ModeMerge}, file, `index:"product" inline:"reviews,reviews" inline:"tags,tags" pk:"id"`},
+		{"merge without file tags", &FileConfig{Mode: ModeMerge}, nil, comment},
+		{"override", &FileConfig{Mode: ModeOverride}, file, `index:"product" inline:"reviews,reviews"`},
+		{"override without file tags", &FileConfig{Mode: ModeOverride}, nil, ``},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.cfg.mergeTags(tt.file, comment); got != tt.want {
+				t.Errorf("mergeTags() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFileConfigComments(t *testing.T) {
+	cfg := &FileConfig{Tables: map[string]*TableConfig{
+		"public.products": {
+			Tags:    TagSet{"filter": {{"status = 'active'"}}},
+			Columns: map[string]TagSet{"Price": {"index": {{"price"}}}},
+		},
+	}}
+	want := []string{
+		`COMMENT ON TABLE "public"."products" IS 'filter:"status = ''active''"'`,
+		`COMMENT ON COLUMN "public"."products"."Price" IS 'index:"price"'`,
+	}
+	if got := cfg.Comments(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Comments() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,592 @@
+package postgres
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/jackc/pgtype"
+)
+
+// ErrFilterSyntax is returned for malformed filter predicate
+var ErrFilterSyntax = errors.New("filter syntax error")
+
+// rowFilter is a predicate over decoded column values. E.G: `filter:"published = true AND deleted_at IS NULL"`
+// Supported: comparisons (= != <> < <= > >=), IS [NOT] NULL, AND, OR, NOT, parentheses,
+// column names (optionally "quoted"), numbers, 'strings', true, false and null.
+// NULL semantics follow SQL: comparison with NULL is unknown, and row matches only if predicate is true.
+// Numbers are compared exactly (as rationals), while strings are compared bytewise (as with "C" collation),
+// so ordering of strings may differ from `WHERE` clause of reindex, if database uses another collation.
+type rowFilter struct {
+	src     string
+	expr    filterExpr
+	fields  []string   // referenced column names
+	columns keyColumns // resolved in Table.init
+}
+
+// parseRowFilter parses predicate
+func parseRowFilter(src string) (*rowFilter, error) {
+	p := &filterParser{lex: filterLexer{src: src}}
+	p.next()
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.err != nil { // lexer error, after the last token
+		return nil, p.err
+	}
+	if p.tok.kind != tokEOF {
+		return nil, p.errorf("unexpected %q", p.tok.text)
+	}
+
+	f := &rowFilter{src: src, expr: expr}
+	seen := make(map[string]bool)
+	walkFilterColumns(expr, func(name string) {
+		if !seen[name] {
+			seen[name] = true
+			f.fields = append(f.fields, name)
+		}
+	})
+	return f, nil
+}
+
+// resolve links referenced names with table columns. Returns names, which are not columns.
+func (f *rowFilter) resolve(t *Table) (unknown []string) {
+	f.columns = f.columns[:0]
+	for _, name := range f.fields {
+		if col, ok := t.columns[name]; ok {
+			f.columns.add(col)
+		} else {
+			unknown = append(unknown, name)
+		}
+	}
+	return unknown
+}
+
+// match evaluates predicate against current column values. Nil filter matches everything.
+func (f *rowFilter) match(lookup func(name string) interface{}) bool {
+	if f == nil {
+		return true
+	}
+	v, _ := f.expr.eval(lookup).(bool)
+	return v
+}
+
+// sql returns predicate as SQL expression, for WHERE clause.
+func (f *rowFilter) sql() string {
+	var b strings.Builder
+	f.expr.sql(&b)
+	return b.String()
+}
+
+// filterExpr is a node of predicate AST
+type filterExpr interface {
+	eval(lookup func(name string) interface{}) interface{} // nil, bool, *big.Rat, string or time.Time
+	sql(b *strings.Builder)
+}
+
+type (
+	filterColumn  string
+	filterLiteral struct {
+		value interface{}
+		src   string // source of number
+	}
+	filterNot    struct{ expr filterExpr }
+	filterIsNull struct {
+		expr filterExpr
+		not  bool
+	}
+	filterLogic struct {
+		op          string // AND, OR
+		left, right filterExpr
+	}
+	filterCompare struct {
+		op          string
+		left, right filterExpr
+	}
+)
+
+func walkFilterColumns(expr filterExpr, fn func(string)) {
+	switch e := expr.(type) {
+	case filterColumn:
+		fn(string(e))
+	case filterNot:
+		walkFilterColumns(e.expr, fn)
+	case filterIsNull:
+		walkFilterColumns(e.expr, fn)
+	case filterLogic:
+		walkFilterColumns(e.left, fn)
+		walkFilterColumns(e.right, fn)
+	case filterCompare:
+		walkFilterColumns(e.left, fn)
+		walkFilterColumns(e.right, fn)
+	}
+}
+
+func (e filterColumn) eval(lookup func(string) interface{}) interface{} {
+	return normalizeFilterValue(lookup(string(e)))
+}
+
+func (e filterColumn) sql(b *strings.Builder) {
+	b.WriteByte('"')
+	b.WriteString(strings.ReplaceAll(string(e), `"`, `""`))
+	b.WriteByte('"')
+}
+
+func (e filterLiteral) eval(func(string) interface{}) interface{} {
+	return e.value
+}
+
+func (e filterLiteral) sql(b *strings.Builder) {
+	switch v := e.value.(type) {
+	case nil:
+		b.WriteString("NULL")
+	case bool:
+		b.WriteString(strconv.FormatBool(v))
+	case *big.Rat:
+		b.WriteString(e.src)
+	case string:
+		b.WriteByte('\'')
+		b.WriteString(strings.ReplaceAll(v, `'`, `''`))
+		b.WriteByte('\'')
+	}
+}
+
+func (e filterNot) eval(lookup func(string) interface{}) interface{} {
+	v, ok := e.expr.eval(lookup).(bool)
+	if !ok {
+		return nil
+	}
+	return !v
+}
+
+func (e filterNot) sql(b *strings.Builder) {
+	b.WriteString("NOT (")
+	e.expr.sql(b)
+	b.WriteByte(')')
+}
+
+func (e filterIsNull) eval(lookup func(string) interface{}) interface{} {
+	return (e.expr.eval(lookup) == nil) != e.not
+}
+
+func (e filterIsNull) sql(b *strings.Builder) {
+	b.WriteByte('(')
+	e.expr.sql(b)
+	if e.not {
+		b.WriteString(" IS NOT NULL)")
+	} else {
+		b.WriteString(" IS NULL)")
+	}
+}
+
+// eval implements three-valued logic
+func (e filterLogic) eval(lookup func(string) interface{}) interface{} {
+	l, lok := e.left.eval(lookup).(bool)
+	r, rok := e.right.eval(lookup).(bool)
+	switch e.op {
+	case "AND":
+		if (lok && !l) || (rok && !r) {
+			return false
+		}
+	case "OR":
+		if (lok && l) || (rok && r) {
+			return true
+		}
+	}
+	if !lok || !rok {
+		return nil
+	}
+	return l && r // both known, and not decided above
+}
+
+func (e filterLogic) sql(b *strings.Builder) {
+	b.WriteByte('(')
+	e.left.sql(b)
+	b.WriteString(" " + e.op + " ")
+	e.right.sql(b)
+	b.WriteByte(')')
+}
+
+func (e filterCompare) eval(lookup func(string) interface{}) interface{} {
+	cmp, ok := compareFilterValues(e.left.eval(lookup), e.right.eval(lookup))
+	if !ok {
+		return nil
+	}
+	switch e.op {
+	case "=":
+		return cmp == 0
+	case "!=", "<>":
+		return cmp != 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	}
+	return nil
+}
+
+func (e filterCompare) sql(b *strings.Builder) {
+	b.WriteByte('(')
+	e.left.sql(b)
+	b.WriteString(" " + e.op + " ")
+	e.right.sql(b)
+	b.WriteByte(')')
+}
+
+// normalizeFilterValue converts decoded column value into one of comparable types
+func normalizeFilterValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case nil, bool, *big.Rat, string, time.Time:
+		return v
+	case int8:
+		return new(big.Rat).SetInt64(int64(v))
+	case int16:
+		return new(big.Rat).SetInt64(int64(v))
+	case int32:
+		return new(big.Rat).SetInt64(int64(v))
+	case int64:
+		return new(big.Rat).SetInt64(v)
+	case int:
+		return new(big.Rat).SetInt64(int64(v))
+	case uint32:
+		return new(big.Rat).SetUint64(uint64(v))
+	case float32:
+		return ratFromFloat(float64(v))
+	case float64:
+		return ratFromFloat(v)
+	case pgtype.Numeric:
+		return ratFromNumeric(v)
+	case []byte:
+		return string(v)
+	case fmt.Stringer:
+		return v.String()
+	case driver.Valuer: // pgtype.Numeric and others
+		dv, err := v.Value()
+		if err != nil {
+			return nil
+		}
+		if _, ok := dv.(driver.Valuer); ok {
+			return nil
+		}
+		return normalizeFilterValue(dv)
+	}
+	return fmt.Sprint(v)
+}
+
+// ratFromFloat converts finite float exactly; NaN and infinity are not comparable
+func ratFromFloat(f float64) interface{} {
+	if r := new(big.Rat).SetFloat64(f); r != nil {
+		return r
+	}
+	return nil
+}
+
+// ratFromNumeric converts numeric exactly: Int * 10^Exp; NaN is not comparable
+func ratFromNumeric(n pgtype.Numeric) interface{} {
+	if n.NaN || n.Int == nil {
+		return nil
+	}
+	exp := int64(n.Exp)
+	if exp < 0 {
+		exp = -exp
+	}
+	pow := new(big.Int).Exp(big.NewInt(10), big.NewInt(exp), nil)
+	if n.Exp < 0 {
+		return new(big.Rat).SetFrac(n.Int, pow)
+	}
+	return new(big.Rat).SetInt(new(big.Int).Mul(n.Int, pow))
+}
+
+var filterTimeLayouts = []string{time.RFC3339Nano, "2006-01-02 15:04:05Z07:00", "2006-01-02 15:04:05", "2006-01-02"}
+
+// compareFilterValues returns -1, 0 or 1. Not ok if values are not comparable, or any of them is NULL
+func compareFilterValues(a, b interface{}) (int, bool) {
+	if a == nil || b == nil {
+		return 0, false
+	}
+	switch av := a.(type) {
+	case *big.Rat:
+		switch bv := b.(type) {
+		case *big.Rat:
+			return av.Cmp(bv), true
+		case string:
+			if r, ok := new(big.Rat).SetString(strings.TrimSpace(bv)); ok {
+				return av.Cmp(r), true
+			}
+		}
+	case string:
+		switch bv := b.(type) {
+		case string:
+			return strings.Compare(av, bv), true
+		case *big.Rat, time.Time:
+			cmp, ok := compareFilterValues(b, a)
+			return -cmp, ok
+		}
+	case bool:
+		if bv, ok := b.(bool); ok {
+			switch {
+			case av == bv:
+				return 0, true
+			case !av:
+				return -1, true
+			}
+			return 1, true
+		}
+	case time.Time:
+		switch bv := b.(type) {
+		case time.Time:
+			return compareTime(av, bv), true
+		case string:
+			for _, layout := range filterTimeLayouts {
+				if t, err := time.Parse(layout, bv); err == nil {
+					return compareTime(av, t), true
+				}
+			}
+		}
+	}
+	return 0, false
+}
+
+func compareTime(a, b time.Time) int {
+	switch {
+	case a.Before(b):
+		return -1
+	case a.After(b):
+		return 1
+	}
+	return 0
+}
+
+type filterTokenKind int
+
+const (
+	tokEOF filterTokenKind = iota
+	tokIdent
+	tokKeyword
+	tokNumber
+	tokString
+	tokOperator
+	tokLParen
+	tokRParen
+)
+
+type filterToken struct {
+	kind filterTokenKind
+	text string // keywords are uppercased
+}
+
+var filterKeywords = map[string]bool{"AND": true, "OR": true, "NOT": true, "IS": true, "NULL": true, "TRUE": true, "FALSE": true}
+
+type filterLexer struct {
+	src string
+	pos int
+}
+
+func (l *filterLexer) next() (filterToken, error) {
+	for l.pos < len(l.src) && unicode.IsSpace(rune(l.src[l.pos])) {
+		l.pos++
+	}
+	if l.pos >= len(l.src) {
+		return filterToken{kind: tokEOF}, nil
+	}
+
+	start := l.pos
+	c := l.src[l.pos]
+	switch {
+	case c == '(':
+		l.pos++
+		return filterToken{kind: tokLParen, text: "("}, nil
+	case c == ')':
+		l.pos++
+		return filterToken{kind: tokRParen, text: ")"}, nil
+	case strings.ContainsRune("=!<>", rune(c)):
+		l.pos++
+		if l.pos < len(l.src) && (l.src[l.pos] == '=' || (c == '<' && l.src[l.pos] == '>')) {
+			l.pos++
+		}
+		op := l.src[start:l.pos]
+		if op == "!" {
+			return filterToken{}, fmt.Errorf("%w: unexpected %q at %d", ErrFilterSyntax, op, start)
+		}
+		return filterToken{kind: tokOperator, text: op}, nil
+	case c == '\'' || c == '"': // 'string' or "quoted identifier"; quote is escaped by doubling
+		var b strings.Builder
+		l.pos++
+		for {
+			if l.pos >= len(l.src) {
+				return filterToken{}, fmt.Errorf("%w: unterminated quote at %d", ErrFilterSyntax, start)
+			}
+			if l.src[l.pos] == c {
+				if l.pos+1 < len(l.src) && l.src[l.pos+1] == c {
+					b.WriteByte(c)
+					l.pos += 2
+					continue
+				}
+				l.pos++
+				break
+			}
+			b.WriteByte(l.src[l.pos])
+			l.pos++
+		}
+		if c == '"' {
+			return filterToken{kind: tokIdent, text: b.String()}, nil
+		}
+		return filterToken{kind: tokString, text: b.String()}, nil
+	case c == '-' || c == '.' || (c >= '0' && c <= '9'):
+		l.pos++
+		for l.pos < len(l.src) && (l.src[l.pos] == '.' || l.src[l.pos] == 'e' || l.src[l.pos] == 'E' || (l.src[l.pos] >= '0' && l.src[l.pos] <= '9')) {
+			l.pos++
+		}
+		return filterToken{kind: tokNumber, text: l.src[start:l.pos]}, nil
+	case c == '_' || unicode.IsLetter(rune(c)):
+		for l.pos < len(l.src) && (l.src[l.pos] == '_' || unicode.IsLetter(rune(l.src[l.pos])) || unicode.IsDigit(rune(l.src[l.pos]))) {
+			l.pos++
+		}
+		word := l.src[start:l.pos]
+		if upper := strings.ToUpper(word); filterKeywords[upper] {
+			return filterToken{kind: tokKeyword, text: upper}, nil
+		}
+		return filterToken{kind: tokIdent, text: word}, nil
+	}
+	return filterToken{}, fmt.Errorf("%w: unexpected %q at %d", ErrFilterSyntax, c, start)
+}
+
+// filterParser is a recursive descent parser. Precedence: OR < AND < NOT < comparison
+type filterParser struct {
+	lex filterLexer
+	tok filterToken
+	err error
+}
+
+func (p *filterParser) next() {
+	if p.err != nil {
+		return
+	}
+	p.tok, p.err = p.lex.next()
+	if p.err != nil {
+		p.tok = filterToken{kind: tokEOF}
+	}
+}
+
+func (p *filterParser) errorf(format string, args ...interface{}) error {
+	if p.err != nil {
+		return p.err
+	}
+	return fmt.Errorf("%w: "+format, append([]interface{}{ErrFilterSyntax}, args...)...)
+}
+
+func (p *filterParser) keyword(word string) bool {
+	return p.tok.kind == tokKeyword && p.tok.text == word
+}
+
+func (p *filterParser) parseOr() (filterExpr, error) {
+	left, err := p.parseAnd()
+	for err == nil && p.keyword("OR") {
+		p.next()
+		var right filterExpr
+		if right, err = p.parseAnd(); err == nil {
+			left = filterLogic{op: "OR", left: left, right: right}
+		}
+	}
+	return left, err
+}
+
+func (p *filterParser) parseAnd() (filterExpr, error) {
+	left, err := p.parseNot()
+	for err == nil && p.keyword("AND") {
+		p.next()
+		var right filterExpr
+		if right, err = p.parseNot(); err == nil {
+			left = filterLogic{op: "AND", left: left, right: right}
+		}
+	}
+	return left, err
+}
+
+func (p *filterParser) parseNot() (filterExpr, error) {
+	if p.keyword("NOT") {
+		p.next()
+		expr, err := p.parseNot()
+		return filterNot{expr: expr}, err
+	}
+	return p.parseComparison()
+}
+
+func (p *filterParser) parseComparison() (filterExpr, error) {
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case p.tok.kind == tokOperator:
+		op := p.tok.text
+		p.next()
+		right, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		return filterCompare{op: op, left: left, right: right}, nil
+	case p.keyword("IS"):
+		p.next()
+		not := p.keyword("NOT")
+		if not {
+			p.next()
+		}
+		if !p.keyword("NULL") {
+			return nil, p.errorf("expected NULL after IS")
+		}
+		p.next()
+		return filterIsNull{expr: left, not: not}, nil
+	}
+	return left, nil // boolean column or literal
+}
+
+func (p *filterParser) parseOperand() (filterExpr, error) {
+	tok := p.tok
+	switch {
+	case tok.kind == tokLParen:
+		p.next()
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.tok.kind != tokRParen {
+			return nil, p.errorf("expected )")
+		}
+		p.next()
+		return expr, nil
+	case tok.kind == tokIdent:
+		p.next()
+		return filterColumn(tok.text), nil
+	case tok.kind == tokString:
+		p.next()
+		return filterLiteral{value: tok.text}, nil
+	case tok.kind == tokNumber:
+		r, ok := new(big.Rat).SetString(tok.text)
+		if !ok {
+			return nil, p.errorf("invalid number %q", tok.text)
+		}
+		p.next()
+		return filterLiteral{value: r, src: tok.text}, nil
+	case tok.kind == tokKeyword && (tok.text == "TRUE" || tok.text == "FALSE"):
+		p.next()
+		return filterLiteral{value: tok.text == "TRUE"}, nil
+	case tok.kind == tokKeyword && tok.text == "NULL":
+		p.next()
+		return filterLiteral{value: nil}, nil
+	case tok.kind == tokEOF:
+		return nil, p.errorf("unexpected end of filter")
+	}
+	return nil, p.errorf("unexpected %q", tok.text)
+}
@@ -0,0 +1,110 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jackc/pglogrepl"
+	"github.com/jackc/pgtype"
+)
+
+func TestRowFilter(t *testing.T) {
+	row := map[string]interface{}{
+		"published":  true,
+		"deleted_at": nil,
+		"rating":     int32(4),
+		"price":      float64(9.5),
+		"status":     "active",
+		"created_at": time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC),
+		"Name":       "O'Reilly",
+		"big_id":     int64(9007199254740993), // 2^53 + 1
+		"amount":     pgtype.Numeric{Int: big.NewInt(12345), Exp: -2, Status: pgtype.Present},
+	}
+	lookup := func(name string) interface{} { return row[name] }
+
+	tests := []struct {
+		src        string
+		wantFields []string
+		wantSQL    string
+		want       bool
+	}{
+		{"published = true AND deleted_at IS NULL", []string{"published", "deleted_at"}, `(("published" = true) AND ("deleted_at" IS NULL))`, true},
+		{"published", []string{"published"}, `"published"`, true},
+		{"NOT published OR rating >= 4", []string{"published", "rating"}, `(NOT ("published") OR ("rating" >= 4))`, true},
+		{"rating > 4", []string{"rating"}, `("rating" > 4)`, false},
+		{"price < 10 and status <> 'deleted'", []string{"price", "status"}, `(("price" < 10) AND ("status" <> 'deleted'))`, true},
+		{"status != 'active'", []string{"status"}, `("status" != 'active')`, false},
+		{`"Name" = 'O''Reilly'`, []string{"Name"}, `("Name" = 'O''Reilly')`, true},
+		{"created_at >= '2026-10-01'", []string{"created_at"}, `("created_at" >= '2026-10-01')`, true},
+		{"deleted_at IS NOT NULL", []string{"deleted_at"}, `("deleted_at" IS NOT NULL)`, false},
+		{"deleted_at = null", []string{"deleted_at"}, `("deleted_at" = NULL)`, false},       // unknown
+		{"NOT (deleted_at = 1)", []string{"deleted_at"}, `NOT (("deleted_at" = 1))`, false}, // NOT unknown is unknown
+		{"deleted_at = 1 OR published", []string{"deleted_at", "published"}, `(("deleted_at" = 1) OR "published")`, true},
+		{"(rating = 1 OR rating = 4) AND (price > -1.5)", []string{"rating", "price"}, `((("rating" = 1) OR ("rating" = 4)) AND ("price" > -1.5))`, true},
+		{"missing = 1", []string{"missing"}, `("missing" = 1)`, false},
+		{"big_id = 9007199254740992", []string{"big_id"}, `("big_id" = 9007199254740992)`, false},
+		{"big_id > 9007199254740992", []string{"big_id"}, `("big_id" > 9007199254740992)`, true},
+		{"amount = 123.45", []string{"amount"}, `("amount" = 123.45)`, true},
+		{"amount > 123.449999999999999999", []string{"amount"}, `("amount" > 123.449999999999999999)`, true},
+		{"amount < 1.2345e2", []string{"amount"}, `("amount" < 1.2345e2)`, false},
+		{"price = 9.5 AND rating = '4'", []string{"price", "rating"}, `(("price" = 9.5) AND ("rating" = '4'))`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			f, err := parseRowFilter(tt.src)
+			if err != nil {
+				t.Fatalf("parseRowFilter() error = %v", err)
+			}
+			if !reflect.DeepEqual(f.fields, tt.wantFields) {
+				t.Errorf("fields = %v, want %v", f.fields, tt.wantFields)
+			}
+			if got := f.sql(); got != tt.wantSQL {
+				t.Errorf("sql() = %s, want %s", got, tt.wantSQL)
+			}
+			if got := f.match(lookup); got != tt.want {
+				t.Errorf("match() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRowFilterSyntaxError(t *testing.T) {
+	for _, src := range []string{
+		"",
+		"published =",
+		"published = true AND",
+		"(published",
+		"published)",
+		"status = 'active",
+		"deleted_at IS 1",
+		"a ! b",
+		"a ; drop table b",
+	} {
+		t.Run(src, func(t *testing.T) {
+			if _, err := parseRowFilter(src); !errors.Is(err, ErrFilterSyntax) {
+				t.Errorf("parseRowFilter() error = %v, want ErrFilterSyntax", err)
+			}
+		})
+	}
+}
+
+func TestRowFilterUnchangedToast(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	full := []string{"id", "body", "status"} // REPLICA IDENTITY FULL
+	db := streamedTable(ctx, t, `pk:"id" filter:"body IS NOT NULL"`, full, full...)
+
+	// body is not changed, thus not sent in new tuple; row still matches
+	update := &pglogrepl.UpdateMessage{RelationID: 10, OldTuple: textTuple("1", "long text", "new"), NewTuple: textTuple("1", nil, "paid")}
+	docs := streamedDocs(ctx, t, db, 100, update)
+	if len(docs) != 1 {
+		t.Fatalf("update with unchanged TOAST streamed %d documents, want 1", len(docs))
+	}
+	if action, _ := bulkAction(t, docs[0]); action != ESUpdate {
+		t.Errorf("update with unchanged TOAST = %s, want document update", action)
+	}
+}
@@ -0,0 +1,188 @@
+package postgres
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pglogrepl"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+// heartbeatPrefix is used for logical messages emitted by replica itself.
+const heartbeatPrefix = "pg2es.heartbeat"
+
+var (
+	metricHeartbeatLatency = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "heartbeat_latency_seconds",
+		Help:    "Round trip time of heartbeat: from write to Postgres, till it's received via streaming replication",
+		Buckets: prometheus.ExponentialBuckets(0.005, 2, 14), // 5ms ... ~40s
+	})
+	metricHeartbeatErrors = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "heartbeat_errors",
+		Help: "Failed heartbeat writes",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(metricHeartbeatLatency)
+	prometheus.MustRegister(metricHeartbeatErrors)
+}
+
+// MessageTypeLogical is a logical decoding message, emitted with pg_logical_emit_message (PG14+).
+// Not supported by pglogrepl yet.
+const MessageTypeLogical pglogrepl.MessageType = 'M'
+
+// LogicalDecodingMessage is a message emitted by `pg_logical_emit_message`.
+// See: https://www.postgresql.org/docs/current/protocol-logicalrep-message-formats.html
+type LogicalDecodingMessage struct {
+	Transactional bool
+	LSN           pglogrepl.LSN
+	Prefix        string
+	Content       []byte
+}
+
+func (m *LogicalDecodingMessage) Type() pglogrepl.MessageType {
+	return MessageTypeLogical
+}
+
+// Decode decodes the message from src, without first message type byte.
+func (m *LogicalDecodingMessage) Decode(src []byte) error {
+	if len(src) < 14 {
+		return fmt.Errorf("LogicalDecodingMessage must be at least 14 bytes, got %d", len(src))
+	}
+	m.Transactional = src[0] == 1
+	m.LSN = pglogrepl.LSN(binary.BigEndian.Uint64(src[1:]))
+	src = src[9:]
+
+	end := strings.IndexByte(string(src), 0)
+	if end < 0 {
+		return errors.New("LogicalDecodingMessage: prefix is not terminated")
+	}
+	m.Prefix = string(src[:end])
+	src = src[end+1:]
+
+	if len(src) < 4 {
+		return errors.New("LogicalDecodingMessage: content length is missing")
+	}
+	size := int(binary.BigEndian.Uint32(src))
+	if len(src[4:]) < size {
+		return fmt.Errorf("LogicalDecodingMessage: content is %d bytes, %d expected", len(src[4:]), size)
+	}
+	m.Content = src[4 : 4+size]
+	return nil
+}
+
+// parseLogical is pglogrepl.Parse with additional message types support.
+func parseLogical(data []byte) (pglogrepl.Message, error) {
+	if len(data) > 0 && pglogrepl.MessageType(data[0]) == MessageTypeLogical {
+		msg := &LogicalDecodingMessage{}
+		return msg, msg.Decode(data[1:])
+	}
+	return pglogrepl.Parse(data)
+}
+
+// heartbeatMessages tells whether heartbeats are sent as logical messages, and `messages` option of pgoutput is required.
+func (db *Database) heartbeatMessages() bool {
+	return db.HeartbeatInterval > 0 && db.HeartbeatTable == ""
+}
+
+// isHeartbeatTable tells whether schema.table is configured as heartbeat table
+func (db *Database) isHeartbeatTable(schema, table string) bool {
+	if db.HeartbeatTable == "" {
+		return false
+	}
+	if !strings.Contains(db.HeartbeatTable, ".") {
+		return schema == "public" && table == db.HeartbeatTable
+	}
+	return db.HeartbeatTable == schema+"."+table
+}
+
+// heartbeatQuery returns query for a single heartbeat.
+// $1 is a slot name, $2 is a current time. Heartbeat table is expected to have `slot_name` PK and `beat_at` columns.
+func (db *Database) heartbeatQuery() string {
+	if db.HeartbeatTable == "" {
+		return `SELECT pg_logical_emit_message(true, '` + heartbeatPrefix + `', $1::text || ' ' || $2::text)`
+	}
+
+	table := `"` + strings.ReplaceAll(db.HeartbeatTable, `"`, `""`) + `"`
+	if parts := strings.SplitN(db.HeartbeatTable, ".", 2); len(parts) == 2 {
+		table = `"` + strings.ReplaceAll(parts[0], `"`, `""`) + `"."` + strings.ReplaceAll(parts[1], `"`, `""`) + `"`
+	}
+	return `INSERT INTO ` + table + ` (slot_name, beat_at) VALUES ($1, $2::timestamptz)
+		ON CONFLICT (slot_name) DO UPDATE SET beat_at = EXCLUDED.beat_at`
+}
+
+// Heartbeat periodically writes into WAL, so replica receives a fresh commit and advances slot position,
+// even if published tables are idle. Blocks until context is canceled.
+func (db *Database) Heartbeat(ctx context.Context) {
+	if db.HeartbeatInterval <= 0 {
+		return
+	}
+	if db.heartbeatMessages() && db.major < 14 {
+		db.logger.Warn("logical messages are not streamed before PG14; heartbeat latency is not measured", zap.String("postgres_version", db.version))
+	}
+
+	query := db.heartbeatQuery()
+	ticker := time.NewTicker(db.HeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		now := time.Now()
+		timeout, cancel := context.WithTimeout(ctx, db.HeartbeatInterval)
+		db.queryConnMu.Lock()
+		res := db.queryConn.ExecParams(timeout, query,
+			[][]byte{[]byte(db.SlotName), []byte(now.Format(time.RFC3339Nano))},
+			nil, nil, nil,
+		).Read()
+		db.queryConnMu.Unlock()
+		cancel()
+
+		if res.Err != nil {
+			metricHeartbeatErrors.Inc()
+			db.logger.Warn("heartbeat failed", zap.Error(res.Err))
+		}
+	}
+}
+
+// heartbeatReceived records heartbeat round trip latency. Send time is taken from heartbeat itself, so lost or overlapping beats are measured correctly.
+func (db *Database) heartbeatReceived(sentAt time.Time) {
+	metricHeartbeatLatency.Observe(time.Since(sentAt).Seconds())
+}
+
+// heartbeatMessageTime parses send time of heartbeat message `<slot> <time>`, emitted by replica of given slot.
+func heartbeatMessageTime(slot string, content []byte) (time.Time, bool) {
+	prefix := slot + " "
+	if !strings.HasPrefix(string(content), prefix) {
+		return time.Time{}, false
+	}
+	sentAt, err := time.Parse(time.RFC3339Nano, string(content[len(prefix):]))
+	return sentAt, err == nil
+}
+
+// heartbeatTime returns `beat_at` of heartbeat table row, written by replica of given slot.
+func (t *Table) heartbeatTime(slot string, tuple *pglogrepl.TupleData) (time.Time, bool) {
+	slotCol, beatCol := t.columns["slot_name"], t.columns["beat_at"]
+	if tuple == nil || slotCol == nil || beatCol == nil || beatCol.value == nil ||
+		slotCol.pos >= len(tuple.Columns) || beatCol.pos >= len(tuple.Columns) {
+		return time.Time{}, false
+	}
+	if string(tuple.Columns[slotCol.pos].Data) != slot { // another replica
+		return time.Time{}, false
+	}
+	if err := beatCol.decode(tuple.Columns[beatCol.pos].Data, tuple.Columns[beatCol.pos].DataType); err != nil || beatCol.Null() || beatCol.Omit() {
+		return time.Time{}, false
+	}
+	sentAt, ok := beatCol.value.Get().(time.Time)
+	return sentAt, ok
+}
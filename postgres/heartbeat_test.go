@@ -0,0 +1,29 @@
+package postgres
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHeartbeatMessageTime(t *testing.T) {
+	sent := time.Date(2026, 10, 18, 12, 0, 0, 123456789, time.UTC)
+	tests := []struct {
+		name    string
+		content string
+		want    time.Time
+		wantOK  bool
+	}{
+		{"own", "replica " + sent.Format(time.RFC3339Nano), sent, true},
+		{"another slot", "replica_2 " + sent.Format(time.RFC3339Nano), time.Time{}, false},
+		{"slot prefix", "replica_2", time.Time{}, false},
+		{"invalid time", "replica yesterday", time.Time{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := heartbeatMessageTime("replica", []byte(tt.content))
+			if ok != tt.wantOK || !got.Equal(tt.want) {
+				t.Errorf("heartbeatMessageTime() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
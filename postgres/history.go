@@ -0,0 +1,110 @@
+package postgres
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/jackc/pglogrepl"
+	jwriter "github.com/mailru/easyjson/jwriter"
+	"go.uber.org/zap"
+)
+
+// Operations in history documents
+const (
+	historyInsert = "insert"
+	historyUpdate = "update"
+	historyDelete = "delete"
+)
+
+// historyChange is a document of append only changes index. E.G: `history:"orders-changes"`
+// Document ID is derived from commit LSN and ordinal number of change in transaction, so replayed changes are not duplicated.
+type historyChange struct {
+	op       string
+	table    *Table
+	tx       transaction
+	ordinal  int
+	lsn      pglogrepl.LSN
+	old, new *pglogrepl.TupleData
+}
+
+// history emits change document into history index of the table, if configured.
+func (db *Database) history(pos Position, op string, table *Table, oldTuple, newTuple *pglogrepl.TupleData) {
+	if table.historyIndex == "" {
+		return
+	}
+	change := historyChange{
+		op:      op,
+		table:   table,
+		tx:      db.tx,
+		ordinal: db.tx.changes,
+		lsn:     pglogrepl.LSN(pos),
+		old:     oldTuple,
+		new:     newTuple,
+	}
+
+	meta, err := change.bulkHeader()
+	if err != nil {
+		table.logger.Error("history document header", zap.Error(err))
+		return
+	}
+	data, err := change.MarshalJSON()
+	if err != nil {
+		table.logger.Error("history document", zap.Error(err))
+		return
+	}
+	db.stream.add(Document{Position: pos, Meta: meta, Data: data})
+}
+
+func (c historyChange) bulkHeader() ([]byte, error) {
+	return bulkHeader{
+		Action: ESCreate,
+		Index:  c.table.historyIndex,
+		ID:     c.tx.finalLSN.String() + "-" + strconv.Itoa(c.ordinal),
+	}.MarshalJSON()
+}
+
+// MarshalJSON encodes change. Old and new values are decoded into table columns one after another.
+func (c historyChange) MarshalJSON() ([]byte, error) {
+	out := jwriter.Writer{}
+	out.RawString(`{"op":`)
+	out.String(c.op)
+	out.RawString(`,"schema":`)
+	out.String(c.table.schema.name)
+	out.RawString(`,"table":`)
+	out.String(c.table.configName())
+	out.RawString(`,"lsn":`)
+	out.String(c.lsn.String())
+	out.RawString(`,"xid":`)
+	out.Uint32(c.tx.xid)
+	out.RawString(`,"commit_time":`)
+	out.String(c.tx.commitTime.UTC().Format(time.RFC3339Nano))
+
+	for _, tuple := range []struct {
+		key   string
+		tuple *pglogrepl.TupleData
+	}{{"old", c.old}, {"new", c.new}} {
+		if tuple.tuple == nil { // not provided by replica identity, or not applicable
+			continue
+		}
+		if err := c.table.decodeTuple(tuple.tuple); err != nil {
+			return nil, err
+		}
+		out.RawString(`,"` + tuple.key + `":`)
+		c.table.historyRow(tuple.key == "old").MarshalEasyJSON(&out)
+	}
+
+	out.RawByte('}')
+	return out.Buffer.BuildBytes(), out.Error
+}
+
+// historyRow lists indexed columns of current row.
+// Old row has only columns of replica identity; others are sent as NULL, while their values are unknown.
+func (t *Table) historyRow(old bool) document {
+	doc := document{keepNulls: true}
+	for _, col := range t.columns {
+		if col.index && (!old || col.oldInWAL) {
+			doc.fields = append(doc.fields, col)
+		}
+	}
+	return doc
+}
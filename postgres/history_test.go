@@ -0,0 +1,40 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/jackc/pglogrepl"
+)
+
+func TestHistoryDeleteDefaultIdentity(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	db := streamedTable(ctx, t, `index:",all" pk:"id" history:"orders-changes"`, []string{"id"}, "id", "body", "status")
+
+	// default replica identity: only PK is sent, other columns are NULL
+	old := &pglogrepl.TupleData{Columns: []*pglogrepl.TupleDataColumn{
+		{DataType: pglogrepl.TupleDataTypeText, Data: []byte("1")},
+		{DataType: pglogrepl.TupleDataTypeNull},
+		{DataType: pglogrepl.TupleDataTypeNull},
+	}}
+	var changes []map[string]interface{}
+	for _, doc := range streamedDocs(ctx, t, db, 100, &pglogrepl.DeleteMessage{RelationID: 10, OldTuple: old}) {
+		if _, params := bulkAction(t, doc); params["_index"] != "orders-changes" {
+			continue
+		}
+		var change map[string]interface{}
+		if err := json.Unmarshal(doc.Data, &change); err != nil {
+			t.Fatalf("unmarshal history document: %v", err)
+		}
+		changes = append(changes, change)
+	}
+	if len(changes) != 1 {
+		t.Fatalf("history documents = %v, want 1", changes)
+	}
+	if got, want := changes[0]["old"], map[string]interface{}{"id": "1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("history old = %v, want %v", got, want)
+	}
+}
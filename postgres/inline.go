@@ -3,6 +3,7 @@ package postgres
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 
 	"github.com/jackc/pglogrepl"
 	jwriter "github.com/mailru/easyjson/jwriter"
@@ -21,8 +22,9 @@ type Inline struct {
 	// temporarily: renaming fields is not possible in this context
 	columns map[string]*Column // By name
 
-	pkCol      *Column
-	parentCol  *Column
+	pkCols     keyColumns        // inline key within parent document. Multiple columns for composite keys
+	parentCols keyColumns        // reference to parent document `_id`, in the same order as parent PK
+	parentRefs map[string]string // parent PK column, referenced by source column. E.G: `inline:"items,parent=tenant_id"`
 	routingCol *Column
 	upsertOnly bool // without old PKs / Parent / _routing in WAL, proper update & delete is impossible
 
@@ -32,33 +34,108 @@ type Inline struct {
 	logger *zap.Logger
 }
 
-// returns inline PK column, which is PK of source table by default
-func (i *Inline) pk() *Column {
-	if i.pkCol == nil { // TODO: strict check for non-nil value
-		i.pkCol = i.source.pkCol
+// returns inline PK columns, which is PK of source table by default
+func (i *Inline) pk() keyColumns {
+	if len(i.pkCols) == 0 { // TODO: strict check for non-nil value
+		i.pkCols = i.source.pkCols
 	}
-	return i.pkCol
+	return i.pkCols
 }
 
-func (i *Inline) init() {
-	if i.parentCol == nil {
-		i.logger.Fatal("parent column is not configured")
+// pkFields returns names of PK fields within inlined object.
+// Single field name is used for simple keys, and list of names for composite ones.
+func (i *Inline) pkFields() interface{} {
+	pk := i.pk()
+	fields := make([]string, len(pk))
+	for n, col := range pk {
+		fields[n] = col.name
+		for name, icol := range i.columns {
+			if icol == col {
+				fields[n] = name
+				break
+			}
+		}
+	}
+	if len(fields) == 1 {
+		return fields[0]
+	}
+	return fields
+}
+
+func (i *Inline) init() error {
+	if i.parent == nil {
+		return i.configError("parent table is not configured")
+	}
+	if len(i.parentCols) == 0 {
+		return i.configError("parent column is not configured")
+	}
+	parentPK, err := i.parent.primaryKey() // parent might be not initialized yet
+	if err != nil {
+		return err
+	}
+	if err := i.orderParentCols(parentPK); err != nil {
+		return err
 	}
 
-	if i.pkCol == nil && i.source.pkCol != nil {
-		i.pkCol = i.source.pkCol
+	if len(i.pkCols) == 0 && len(i.source.pkCols) > 0 {
+		i.pkCols = i.source.pkCols
 		i.logger.Info("using implicit PK column")
 	}
-	if i.pkCol == nil {
-		i.logger.Fatal("PK column is not configured")
+	if len(i.pkCols) == 0 {
+		return i.configError("PK column is not configured")
 	}
 
-	if !i.pkCol.oldInWAL || !i.parentCol.oldInWAL {
+	if !i.pkCols.inWAL() || !i.parentCols.inWAL() || !i.templateColumns().inWAL() {
 		i.upsertOnly = true
 	}
 	if i.routingCol != nil && !i.routingCol.oldInWAL {
 		i.upsertOnly = true
 	}
+	if p := i.parent.partition; p != nil && i.source.columns[p.name] == nil {
+		return i.configError("source table has no parent partition column %q", p.name)
+	}
+	return nil
+}
+
+// orderParentCols orders reference columns as parent PK, by names of referenced parent PK columns.
+// Name can be omitted (`parent`), only if parent PK has single column.
+func (i *Inline) orderParentCols(parentPK keyColumns) error {
+	if len(parentPK) == 0 {
+		return nil // parent `_id` is templated, E.G: `id:"{{.tenant_id}}:{{.id}}"`
+	}
+	if len(i.parentCols) != len(parentPK) {
+		return i.configError("parent columns %v do not match parent PK %v", i.parentCols.names(), parentPK.names())
+	}
+	ordered := make(keyColumns, len(parentPK))
+	for _, col := range i.parentCols {
+		name := i.parentRefs[col.name]
+		if name == "" {
+			if len(parentPK) > 1 {
+				return i.configError("parent column %q should name parent PK column, one of %v. E.G: parent=%s", col.name, parentPK.names(), parentPK[0].name)
+			}
+			name = parentPK[0].name
+		}
+		n := -1
+		for pos, pkCol := range parentPK {
+			if pkCol.name == name {
+				n = pos
+			}
+		}
+		switch {
+		case n < 0:
+			return i.configError("parent column %q references %q, which is not in parent PK %v", col.name, name, parentPK.names())
+		case ordered[n] != nil:
+			return i.configError("parent PK column %q is referenced by %q and %q", name, ordered[n].name, col.name)
+		}
+		ordered[n] = col
+	}
+	i.parentCols = ordered
+	return nil
+}
+
+// configError wraps ErrInvalidConfig with inline name
+func (i *Inline) configError(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: inline %s: %s", ErrInvalidConfig, i.name, fmt.Sprintf(format, args...))
 }
 
 // keysChanged tells whether inline needs to be recreated or updated
@@ -67,17 +144,15 @@ func (i *Inline) tupleKeysChanged(oldTuple, newTuple *pglogrepl.TupleData) bool
 		return false
 	}
 
-	if !bytes.Equal(
-		oldTuple.Columns[i.parentCol.pos].Data,
-		newTuple.Columns[i.parentCol.pos].Data,
-	) {
+	if i.parentCols.changed(oldTuple, newTuple) {
 		return true
 	}
 
-	if !bytes.Equal(
-		oldTuple.Columns[i.pkCol.pos].Data,
-		newTuple.Columns[i.pkCol.pos].Data,
-	) {
+	if i.pkCols.changed(oldTuple, newTuple) {
+		return true
+	}
+
+	if i.templateColumns().changed(oldTuple, newTuple) {
 		return true
 	}
 
@@ -91,23 +166,62 @@ func (i *Inline) tupleKeysChanged(oldTuple, newTuple *pglogrepl.TupleData) bool
 	return false
 }
 
-func (i *Inline) elasticBulkHeader(action ESAction) ([]byte, error) {
+func (i *Inline) elasticBulkHeader(action ESAction) (_ []byte, err error) {
 	header := bulkHeader{
 		Action: ESUpdate,
 		Index:  i.parent.indexName,
-		ID:     i.parentCol.string(),
+		ID:     i.parentCols.string(i.parent.pkSep),
 	}
 
 	if !i.parent.pkNoPrefix {
-		header.ID = i.parent.name + "_" + header.ID
+		header.ID = i.parent.configName() + defaultKeySeparator + header.ID
 	}
 	if i.routingCol != nil {
 		header.Routing = i.routingCol.string()
 	}
 
+	// parent document address might be templated
+	if i.parent.idTmpl != nil || i.parent.routingTmpl != nil || i.parent.dynamicTarget() || i.parent.partition != nil {
+		data := i.parentTemplateData()
+		if i.parent.idTmpl != nil {
+			if header.ID, err = i.parent.idTmpl.execute(data); err != nil {
+				return nil, err
+			}
+		}
+		if i.parent.routingTmpl != nil { // parent document is routed by template, rather than by inline routing column
+			if header.Routing, err = i.parent.routingTmpl.execute(data); err != nil {
+				return nil, err
+			}
+		}
+		if i.parent.dynamicTarget() {
+			if header.Index, err = i.parent.targetTmpl.execute(data); err != nil {
+				return nil, err
+			}
+			if header.Index, err = sanitizeIndexName(header.Index); err != nil {
+				return nil, err
+			}
+		}
+		if p := i.parent.partition; p != nil { // parent partition column is taken from source by name
+			header.Index, _ = p.target(header.Index, i.source.columns[p.name], i.parent)
+		}
+	}
+
 	return json.Marshal(header)
 }
 
+// keyColumn tells whether column is required to address parent document or inlined object
+func (i *Inline) keyColumn(col *Column) bool {
+	if _, ok := i.columns[col.name]; ok {
+		return true
+	}
+	for _, icol := range i.columns {
+		if icol == col {
+			return true
+		}
+	}
+	return i.pk().contains(col) || i.parentCols.contains(col) || i.routingCol == col || i.templateColumns().contains(col)
+}
+
 func (inline *Inline) jsonEncodeRow(buf *jwriter.Writer) {
 	doc := document{}
 	for _, col := range inline.columns { // add real columns
@@ -127,23 +241,27 @@ func (inline *Inline) jsonAddScript() ([]byte, error) {
 	inline.jsonEncodeRow(&out)
 
 	out.RawString(`,"pk":`)
-	out.String(inline.pk().name)
+	out.Raw(json.Marshal(inline.pkFields()))
 	out.RawString(`,"inline":`)
 	out.String(inline.fieldName)
 	out.RawByte('}')
 
-	pCol := inline.parentCol
 	out.RawString(`},`)
 
 	// default values for empty document with inlined field
 	// TODO: reuse from parent table or remove completely
 	out.RawString(`"upsert":{"docType":`)
 
-	out.String(inline.parent.name)
-	out.RawByte(',')
-	out.String(inline.parent.pkCol.name)
-	out.RawByte(':')
-	out.Raw(pCol.MarshalJSON())
+	out.String(inline.parent.configName())
+	for n, pCol := range inline.parentCols {
+		if n >= len(inline.parent.pkCols) {
+			break
+		}
+		out.RawByte(',')
+		out.String(inline.parent.pkCols[n].name)
+		out.RawByte(':')
+		out.Raw(pCol.MarshalJSON())
+	}
 
 	out.RawString(`}}`)
 
@@ -159,7 +277,7 @@ func (inline *Inline) jsonDelScript() ([]byte, error) {
 	inline.jsonEncodeRow(&out)
 
 	out.RawString(`,"pk":`)
-	out.String(inline.pk().name)
+	out.Raw(json.Marshal(inline.pkFields()))
 	out.RawString(`,"inline":`)
 	out.String(inline.fieldName)
 	out.RawString(`}`)
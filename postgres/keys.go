@@ -0,0 +1,101 @@
+package postgres
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+
+	"github.com/jackc/pglogrepl"
+)
+
+// defaultKeySeparator joins values of composite keys, and document type prefix of `_id`
+const defaultKeySeparator = "_"
+
+// keyColumns is an ordered set of columns, which form a (composite) key. E.G: PK or reference to parent document.
+type keyColumns []*Column
+
+// add appends column to the key, keeping columns in table order (attnum)
+func (k *keyColumns) add(col *Column) {
+	if k.contains(col) {
+		return
+	}
+	*k = append(*k, col)
+	sort.SliceStable(*k, func(i, j int) bool { return (*k)[i].num < (*k)[j].num })
+}
+
+// remove deletes column from the key
+func (k *keyColumns) remove(col *Column) {
+	if !k.contains(col) {
+		return
+	}
+	rest := make(keyColumns, 0, len(*k)-1) // backing array might be shared (E.G: implicit inline PK)
+	for _, c := range *k {
+		if c != col {
+			rest = append(rest, c)
+		}
+	}
+	*k = rest
+}
+
+func (k keyColumns) contains(col *Column) bool {
+	for _, c := range k {
+		if c == col {
+			return true
+		}
+	}
+	return false
+}
+
+// string joins string representation of column values
+func (k keyColumns) string(sep string) string {
+	if len(k) == 1 {
+		return k[0].string()
+	}
+	values := make([]string, len(k))
+	for i, col := range k {
+		values[i] = col.string()
+	}
+	return strings.Join(values, sep)
+}
+
+// inWAL tells whether all old values are stored in WAL
+func (k keyColumns) inWAL() bool {
+	for _, col := range k {
+		if !col.oldInWAL {
+			return false
+		}
+	}
+	return true
+}
+
+// toasted tells whether any value in tuple is unchanged TOAST, which is not sent in WAL
+func (k keyColumns) toasted(tuple *pglogrepl.TupleData) bool {
+	for _, col := range k {
+		if col.pos < len(tuple.Columns) && tuple.Columns[col.pos].DataType == pglogrepl.TupleDataTypeToast {
+			return true
+		}
+	}
+	return false
+}
+
+// changed compares raw values of key columns in old and new tuples.
+func (k keyColumns) changed(oldTuple, newTuple *pglogrepl.TupleData) bool {
+	for _, col := range k {
+		if !bytes.Equal(
+			oldTuple.Columns[col.pos].Data,
+			newTuple.Columns[col.pos].Data,
+		) {
+			return true
+		}
+	}
+	return false
+}
+
+// names returns SQL column names
+func (k keyColumns) names() []string {
+	names := make([]string, len(k))
+	for i, col := range k {
+		names[i] = col.name
+	}
+	return names
+}
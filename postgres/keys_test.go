@@ -0,0 +1,161 @@
+package postgres
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/jackc/pgtype"
+	"go.uber.org/zap"
+)
+
+// keysTable creates table with given columns (in attnum order) and values.
+func keysTable(t *testing.T, tag string, columns []string, values []string) *Table {
+	t.Helper()
+	db := New(nil, zap.NewNop())
+	db.name = "shop"
+	table := db.schema("public").table("orders")
+	if err := table.parseStructTag(tag); err != nil {
+		t.Fatalf("parseStructTag() error = %v", err)
+	}
+	for i, name := range columns {
+		col := table.Column(name)
+		col.num = i + 1
+		col.value = &pgtype.Text{String: values[i], Status: pgtype.Present}
+	}
+	return table
+}
+
+func TestKeyColumnsOrder(t *testing.T) {
+	table := keysTable(t, "", []string{"id", "tenant_id", "region"}, []string{"1", "acme", "eu"})
+	var k keyColumns
+	for _, name := range []string{"region", "id", "tenant_id", "id"} {
+		k.add(table.columns[name])
+	}
+	if got, want := k.names(), []string{"id", "tenant_id", "region"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("add() names = %v, want %v", got, want)
+	}
+
+	shared := k
+	k.remove(table.columns["tenant_id"])
+	if got, want := k.names(), []string{"id", "region"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("remove() names = %v, want %v", got, want)
+	}
+	if got, want := shared.names(), []string{"id", "tenant_id", "region"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("remove() changed shared key = %v, want %v", got, want)
+	}
+	if got, want := k.string("/"), "1/eu"; got != want {
+		t.Errorf("string() = %q, want %q", got, want)
+	}
+}
+
+func TestTablePK(t *testing.T) {
+	tests := []struct {
+		name    string
+		tag     string
+		sqlPK   []string
+		wantErr bool
+		wantPK  []string
+		wantID  string
+	}{
+		{"implicit", "", []string{"tenant_id", "id"}, false, []string{"id", "tenant_id"}, "orders_1_acme"},
+		{"explicit order", `pk:"tenant_id,id"`, nil, false, []string{"tenant_id", "id"}, "orders_acme_1"},
+		{"separator", `pk:"tenant_id,id" pksep:":"`, nil, false, []string{"tenant_id", "id"}, "orders_acme:1"},
+		{"explicit overrides implicit", `pk:"id"`, []string{"tenant_id"}, false, []string{"id"}, "orders_1"},
+		{"unknown column", `pk:"tenant,id"`, nil, true, nil, ""},
+		{"autoid without append", `index:",autoid"`, []string{"id"}, true, nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			table := keysTable(t, tt.tag, []string{"id", "tenant_id"}, []string{"1", "acme"})
+			for _, name := range tt.sqlPK {
+				table.columns[name].sqlPK = true
+			}
+			err := table.init()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("init() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got := table.pkCols.names(); !reflect.DeepEqual(got, tt.wantPK) {
+				t.Errorf("init() pk = %v, want %v", got, tt.wantPK)
+			}
+			data, err := table.elasticBulkHeader(ESIndex)
+			if err != nil {
+				t.Fatalf("elasticBulkHeader() error = %v", err)
+			}
+			var header map[string]map[string]interface{}
+			if err := json.Unmarshal(data, &header); err != nil {
+				t.Fatalf("unmarshal header: %v", err)
+			}
+			if got := header["index"]["_id"]; got != tt.wantID {
+				t.Errorf("elasticBulkHeader() _id = %v, want %q", got, tt.wantID)
+			}
+		})
+	}
+}
+
+func TestTablePKNotShared(t *testing.T) {
+	table := keysTable(t, `pk:"tenant_id,id"`, []string{"id", "tenant_id"}, []string{"1", "acme"})
+	implicit := keyColumns{table.columns["id"]} // E.G: inline PK, taken from source table
+	table.pkCols = implicit
+	if err := table.init(); err != nil {
+		t.Fatalf("init() error = %v", err)
+	}
+	if got, want := implicit.names(), []string{"id"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("init() changed shared key = %v, want %v", got, want)
+	}
+}
+
+func TestInlineParentColumns(t *testing.T) {
+	tests := []struct {
+		name     string
+		parentPK string
+		refs     map[string]string // source column -> tag
+		wantErr  bool
+		wantID   string
+	}{
+		{"named composite", `pk:"tenant_id,id"`, map[string]string{"order_id": `inline:"items,parent=id"`, "tenant_id": `inline:"items,parent=tenant_id"`}, false, "orders_acme_5"},
+		{"unnamed single", `pk:"id"`, map[string]string{"order_id": `inline:"items,parent"`}, false, "orders_5"},
+		{"unnamed composite", `pk:"tenant_id,id"`, map[string]string{"order_id": `inline:"items,parent"`, "tenant_id": `inline:"items,parent"`}, true, ""},
+		{"unknown parent column", `pk:"tenant_id,id"`, map[string]string{"order_id": `inline:"items,parent=order_id"`, "tenant_id": `inline:"items,parent=tenant_id"`}, true, ""},
+		{"referenced twice", `pk:"tenant_id,id"`, map[string]string{"order_id": `inline:"items,parent=id"`, "tenant_id": `inline:"items,parent=id"`}, true, ""},
+		{"missing reference", `pk:"tenant_id,id"`, map[string]string{"order_id": `inline:"items,parent=id"`}, true, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parent := keysTable(t, tt.parentPK+` inline:"items"`, []string{"id", "tenant_id"}, []string{"5", "acme"})
+			source := parent.schema.table("items")
+			source.parseStructTag("")
+			for n, name := range []string{"id", "order_id", "tenant_id"} { // order_id is declared before tenant_id
+				col := source.Column(name)
+				col.num = n + 1
+				col.value = &pgtype.Text{String: map[string]string{"id": "1", "order_id": "5", "tenant_id": "acme"}[name], Status: pgtype.Present}
+				if err := col.parseStructTag(tt.refs[name]); err != nil {
+					t.Fatalf("parseStructTag() error = %v", err)
+				}
+			}
+			source.columns["id"].sqlPK = true
+
+			err := source.init()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("init() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			data, err := parent.schema.inlines["items"].elasticBulkHeader(ESUpdate)
+			if err != nil {
+				t.Fatalf("elasticBulkHeader() error = %v", err)
+			}
+			var header map[string]map[string]interface{}
+			if err := json.Unmarshal(data, &header); err != nil {
+				t.Fatalf("unmarshal header: %v", err)
+			}
+			if got := header["update"]["_id"]; got != tt.wantID {
+				t.Errorf("elasticBulkHeader() _id = %v, want %q", got, tt.wantID)
+			}
+		})
+	}
+}
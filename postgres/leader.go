@@ -0,0 +1,68 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgtype"
+	"go.uber.org/zap"
+)
+
+// leaderLockQuery tries to take session level advisory lock. Lock is released automatically, when connection is closed.
+// $1 is a lock name, derived from slot name, so replicas of different slots do not interfere.
+const leaderLockQuery = `SELECT pg_try_advisory_lock(hashtext($1))`
+
+// AcquireLeadership blocks until this replica becomes a leader, or context is canceled.
+// Only one replica can stream from a slot at a time. Others stay warm in standby, and take over once the leader is gone.
+//
+// Leader holds advisory lock on query connection. In addition, slot should not be active,
+// since previous leader might still be streaming while its query connection is gone.
+func (db *Database) AcquireLeadership(ctx context.Context, interval time.Duration) error {
+	lockName := []byte("pg2es/" + db.SlotName)
+	locked := false
+	logged := false
+
+	for {
+		if !locked {
+			db.queryConnMu.Lock()
+			res := db.queryConn.ExecParams(ctx, leaderLockQuery, [][]byte{lockName}, nil, nil, []int16{binT}).Read()
+			db.queryConnMu.Unlock()
+			if res.Err != nil {
+				return fmt.Errorf("acquire leader lock: %w", res.Err)
+			}
+			var ok pgtype.Bool
+			if err := ok.DecodeBinary(db.connInfo, res.Rows[0][0]); err != nil {
+				return fmt.Errorf("decode leader lock: %w", err)
+			}
+			locked = ok.Bool
+		}
+
+		if locked {
+			status, err := db.SlotStatus(ctx)
+			switch {
+			case errors.Is(err, ErrSlotNotFound):
+				db.logger.Info("became a leader", zap.String("slot", db.SlotName))
+				return nil
+			case err != nil:
+				return err
+			case !status.Active || status.ActivePID == db.replConn.PID():
+				db.logger.Info("became a leader", zap.String("slot", db.SlotName))
+				return nil
+			}
+			if !logged {
+				db.logger.Info("leader lock is acquired; waiting for previous leader to release the slot", zap.Uint32("active_pid", status.ActivePID))
+			}
+		} else if !logged {
+			db.logger.Info("standby: another replica is a leader", zap.String("slot", db.SlotName))
+		}
+		logged = true
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package postgres
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Replication metadata, which can be added to documents. E.G: `meta:"lsn,commit_time=_ts,processed_at"`
+const (
+	MetaLSN         = "lsn"          // commit LSN of transaction
+	MetaCommitTime  = "commit_time"  // commit timestamp of transaction
+	MetaXID         = "xid"          // transaction id
+	MetaSchema      = "schema"       // source schema
+	MetaTable       = "table"        // source table
+	MetaProcessedAt = "processed_at" // time, when change was processed by replica
+)
+
+// metaField is a metadata field, optionally renamed in document: `name=field`
+type metaField struct {
+	name string
+	key  string
+}
+
+// parseMetaFields parses `meta` tag values
+func parseMetaFields(values []string) (fields []metaField, err error) {
+	for _, v := range values {
+		name, key := v, v
+		if i := strings.IndexByte(v, '='); i >= 0 {
+			name, key = v[:i], v[i+1:]
+		}
+		switch name {
+		case MetaLSN, MetaCommitTime, MetaXID, MetaSchema, MetaTable, MetaProcessedAt:
+		default:
+			return nil, fmt.Errorf("unknown meta field %q", name)
+		}
+		if key == "" {
+			return nil, fmt.Errorf("empty name of meta field %q", name)
+		}
+		fields = append(fields, metaField{name: name, key: key})
+	}
+	return fields, nil
+}
+
+// metaKV is encoded metadata value. Nil value is omitted (E.G: transaction fields during reindex)
+type metaKV struct {
+	key   string
+	value []byte
+}
+
+func (kv metaKV) jsonKey() string {
+	return kv.key
+}
+
+func (kv metaKV) Omit() bool {
+	return kv.value == nil
+}
+
+func (kv metaKV) MarshalJSON() ([]byte, error) {
+	return kv.value, nil
+}
+
+// metaFields returns configured metadata of current change
+func (t *Table) metaFields() []jsonKV {
+	if len(t.meta) == 0 {
+		return nil
+	}
+	tx := t.schema.database.tx
+	fields := make([]jsonKV, 0, len(t.meta))
+	for _, mf := range t.meta {
+		kv := metaKV{key: mf.key}
+		switch mf.name {
+		case MetaLSN:
+			if tx.finalLSN != 0 {
+				kv.value = []byte(strconv.Quote(tx.finalLSN.String()))
+			}
+		case MetaCommitTime:
+			if !tx.commitTime.IsZero() {
+				kv.value = []byte(strconv.Quote(tx.commitTime.UTC().Format(time.RFC3339Nano)))
+			}
+		case MetaXID:
+			if tx.xid != 0 {
+				kv.value = strconv.AppendUint(nil, uint64(tx.xid), 10)
+			}
+		case MetaSchema:
+			kv.value = []byte(strconv.Quote(t.schema.name))
+		case MetaTable:
+			kv.value = []byte(strconv.Quote(t.configName()))
+		case MetaProcessedAt:
+			kv.value = []byte(strconv.Quote(time.Now().UTC().Format(time.RFC3339Nano)))
+		}
+		fields = append(fields, kv)
+	}
+	return fields
+}
@@ -0,0 +1,112 @@
+package postgres
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+// Time based index periods. Index name suffix is formatted by layout.
+const (
+	PeriodDaily   = "daily"
+	PeriodMonthly = "monthly"
+	PeriodYearly  = "yearly"
+)
+
+var periodLayouts = map[string]string{
+	PeriodDaily:   "2006.01.02",
+	PeriodMonthly: "2006.01",
+	PeriodYearly:  "2006",
+}
+
+// ErrNoPartitionTime is returned when partition column has no time value (NULL or infinity).
+var ErrNoPartitionTime = errors.New("no partition time")
+
+var metricPartitionFallbacks = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "partition_fallbacks",
+	Help: "Documents written into fallback index, since partition column has no time value",
+}, []string{"table"})
+
+func init() {
+	prometheus.MustRegister(metricPartitionFallbacks)
+}
+
+// timePartition splits table documents into time based indices, by timestamp column. E.G: `partition:"created_at,monthly"` -> `events-2026.10`
+type timePartition struct {
+	name     string  // column name
+	col      *Column // resolved in Table.init
+	layout   string  // index suffix layout
+	fallback string  // index for rows without time value; base index if empty
+}
+
+// parseTimePartition parses `partition` tag values: column name, optional period (monthly by default) and fallback index.
+func parseTimePartition(values []string) (*timePartition, error) {
+	if values[0] == "" {
+		return nil, errors.New("partition column is required")
+	}
+	period := PeriodMonthly
+	if len(values) > 1 && values[1] != "" {
+		period = values[1]
+	}
+	layout, ok := periodLayouts[period]
+	var err error
+	if !ok {
+		return nil, fmt.Errorf("unknown partition period %q", period)
+	}
+	p := &timePartition{name: values[0], layout: layout}
+	if len(values) > 2 && values[2] != "" {
+		if p.fallback, err = sanitizeIndexName(values[2]); err != nil {
+			return nil, fmt.Errorf("partition fallback: %w", err)
+		}
+	}
+	return p, nil
+}
+
+// index returns name of time based index for current value of given column
+func (p *timePartition) index(base string, col *Column) (string, error) {
+	if col == nil || col.value == nil || col.Null() || col.Omit() {
+		return "", fmt.Errorf("%w: column %s is not available", ErrNoPartitionTime, p.name)
+	}
+	ts, ok := col.value.Get().(time.Time)
+	if !ok {
+		return "", fmt.Errorf("%w: column %s value %q", ErrNoPartitionTime, p.name, col.string())
+	}
+	return base + "-" + ts.UTC().Format(p.layout), nil
+}
+
+// target returns time based index, or fallback one (without counting as time based), if column has no time value.
+func (p *timePartition) target(base string, col *Column, t *Table) (name string, timeBased bool) {
+	name, err := p.index(base, col)
+	if err == nil {
+		return name, true
+	}
+	metricPartitionFallbacks.WithLabelValues(t.name).Inc()
+	name = base
+	if p.fallback != "" {
+		name = p.fallback
+	}
+	t.logger.Warn("document is written into fallback index", zap.String("index", name), zap.Error(err))
+	return name, false
+}
+
+// CreateIndex is sent into stream before the first document of a new time based index.
+// Consumer should create the index, so it is configured by matching index template.
+type CreateIndex struct {
+	Position
+	Index string
+}
+
+// ensureIndex emits CreateIndex once per index name.
+func (db *Database) ensureIndex(name string) {
+	if db.parent != nil {
+		db.parent.ensureIndex(name)
+		return
+	}
+	if _, loaded := db.knownIndices.LoadOrStore(name, struct{}{}); loaded {
+		return
+	}
+	db.stream.add(CreateIndex{Index: name})
+}
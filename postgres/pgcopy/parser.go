@@ -18,16 +18,27 @@ import (
 
 var (
 	ErrInvalidSignature = errors.New(`invalid file signature: expected PGCOPY\n\377\r\n\0`)
+	ErrClosed           = errors.New("parser is closed")
 )
 
 const signature = "PGCOPY\n\377\r\n\x00" // \0 is replaced with \x00, due to Golang syntax
 
 type Parser struct {
-	ch chan [][]byte
+	ch   chan [][]byte
+	done chan struct{}
 }
 
 func NewParser() *Parser {
-	return &Parser{ch: make(chan [][]byte)}
+	return &Parser{ch: make(chan [][]byte), done: make(chan struct{})}
+}
+
+// Close stops parsing, in case if rows are not read till the end.
+func (p *Parser) Close() {
+	select {
+	case <-p.done:
+	default:
+		close(p.done)
+	}
 }
 
 func (p *Parser) Next(ctx context.Context) ([][]byte, error) {
@@ -96,7 +107,11 @@ func (p *Parser) Parse(r io.Reader) error {
 				return fmt.Errorf("can't read column: %w", err)
 			}
 		}
-		p.ch <- row
+		select {
+		case p.ch <- row:
+		case <-p.done:
+			return ErrClosed
+		}
 	}
 
 	close(p.ch)
@@ -0,0 +1,166 @@
+package postgres
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgtype"
+	"go.uber.org/zap"
+)
+
+// discoverPublicationQuery selects options of publications per published table.
+//
+//go:embed queries/discover_publication_query.sql
+var discoverPublicationQuery string
+
+// publishedTable is a combined view of all publications, which include the table.
+// Changes are sent if any of publications sends them.
+type publishedTable struct {
+	publications []string
+	insert       bool
+	update       bool
+	delete       bool
+	truncate     bool
+	viaRoot      bool            // changes of partitions are published as changes of root table
+	columns      map[string]bool // PG15+ column list; nil means all columns
+	rowFilters   []string        // PG15+ row filters; empty if at least one publication has none
+	allColumns   bool            // at least one publication has no column list
+	unfiltered   bool            // at least one publication has no row filter
+}
+
+// add merges options of single publication
+func (p *publishedTable) add(pubname string, insert, update, delete, truncate, viaRoot bool, columns []string, rowFilter string) {
+	p.publications = append(p.publications, pubname)
+	p.insert = p.insert || insert
+	p.update = p.update || update
+	p.delete = p.delete || delete
+	p.truncate = p.truncate || truncate
+	p.viaRoot = p.viaRoot || viaRoot
+
+	if columns == nil {
+		p.allColumns = true
+	}
+	if p.allColumns {
+		p.columns = nil
+	} else {
+		if p.columns == nil {
+			p.columns = make(map[string]bool, len(columns))
+		}
+		for _, name := range columns {
+			p.columns[name] = true
+		}
+	}
+
+	if rowFilter == "" {
+		p.unfiltered = true
+	}
+	if p.unfiltered {
+		p.rowFilters = nil
+	} else {
+		p.rowFilters = append(p.rowFilters, rowFilter)
+	}
+}
+
+// published tells whether column is sent by publication
+func (p *publishedTable) published(column string) bool {
+	return p == nil || p.columns == nil || p.columns[column]
+}
+
+// publicationNames formats `publication_names` option of pgoutput.
+// Each name is quoted as identifier, and the whole list as literal.
+func publicationNames(publications []string) string {
+	names := make([]string, len(publications))
+	for i, name := range publications {
+		names[i] = quoteIdent(name)
+	}
+	return "'" + strings.ReplaceAll(strings.Join(names, ","), "'", "''") + "'"
+}
+
+// publicationsParam encodes publication names as text[] query parameter
+func (db *Database) publicationsParam() []byte {
+	arr := pgtype.TextArray{}
+	if err := arr.Set(db.Publications); err != nil {
+		db.logger.Fatal("invalid publication names", zap.Error(err))
+	}
+	buf, err := arr.EncodeText(db.connInfo, nil)
+	if err != nil {
+		db.logger.Fatal("invalid publication names", zap.Error(err))
+	}
+	return buf
+}
+
+// discoverPublications returns publication options by `schema.table`, optionally limited to schema and table (nil means any)
+func (db *Database) discoverPublications(ctx context.Context, schema, table []byte) (map[string]*publishedTable, error) {
+	db.queryConnMu.Lock()
+	res := db.queryConn.ExecParams(ctx, discoverPublicationQuery, [][]byte{db.publicationsParam(), schema, table}, nil, nil, nil).Read()
+	db.queryConnMu.Unlock()
+	if res.Err != nil {
+		return nil, fmt.Errorf("discover publications: %w", res.Err)
+	}
+
+	published := make(map[string]*publishedTable)
+	for _, row := range res.Rows {
+		name := string(row[0]) + "." + string(row[1])
+		p, ok := published[name]
+		if !ok {
+			p = &publishedTable{}
+			published[name] = p
+		}
+		var columns []string
+		if row[8] != nil {
+			if err := json.Unmarshal(row[8], &columns); err != nil {
+				return nil, fmt.Errorf("decode column list of %s: %w", name, err)
+			}
+		}
+		isTrue := func(v []byte) bool { return string(v) == "t" }
+		p.add(string(row[2]), isTrue(row[3]), isTrue(row[4]), isTrue(row[5]), isTrue(row[6]), isTrue(row[7]), columns, string(row[9]))
+	}
+	return published, nil
+}
+
+// referencedColumns returns names of columns, referenced by table level config
+func (t *Table) referencedColumns() (names []string) {
+	names = append(names, t.pkNames...)
+	if t.timestampName != "" {
+		names = append(names, t.timestampName)
+	}
+	if t.partition != nil {
+		names = append(names, t.partition.name)
+	}
+	if t.filter != nil {
+		names = append(names, t.filter.fields...)
+	}
+	for _, rt := range t.templates() {
+		names = append(names, rt.fields...)
+	}
+	return names
+}
+
+// checkPublication warns about config, which can not be satisfied by publication options
+func (t *Table) checkPublication() {
+	p := t.publication
+	if p == nil || !t.index {
+		return
+	}
+	pubs := zap.Strings("publications", p.publications)
+	if !p.insert {
+		t.logger.Warn("inserts are not published; new rows are not indexed", pubs)
+	}
+	if !p.update {
+		t.logger.Warn("updates are not published; documents are not updated", pubs)
+	}
+	if !p.delete && t.delete.mode != DeleteIgnore {
+		t.logger.Warn("deletes are not published; documents are not deleted", pubs)
+	}
+	if len(p.rowFilters) > 0 {
+		t.logger.Info("publication row filter is applied; rows which stop matching it are deleted", pubs, zap.Strings("row_filters", p.rowFilters))
+	}
+	for _, name := range t.referencedColumns() {
+		if t.unpublished[name] {
+			t.logger.Warn("config references column, which is not published", pubs, zap.String("column", name))
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package postgres
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPublicationNames(t *testing.T) {
+	tests := []struct {
+		publications []string
+		want         string
+	}{
+		{[]string{"search"}, `'"search"'`},
+		{[]string{"search", "Audit"}, `'"search","Audit"'`},
+		{[]string{`we"ird`, "it's"}, `'"we""ird","it''s"'`},
+	}
+	for _, tt := range tests {
+		if got := publicationNames(tt.publications); got != tt.want {
+			t.Errorf("publicationNames(%q) = %s, want %s", tt.publications, got, tt.want)
+		}
+	}
+}
+
+func TestPublishedTableAdd(t *testing.T) {
+	p := &publishedTable{}
+	p.add("a", true, false, false, false, false, []string{"id", "name"}, "(published = true)")
+	p.add("b", false, true, false, false, true, []string{"id", "price"}, "(price > 0)")
+
+	if !p.insert || !p.update || p.delete || !p.viaRoot {
+		t.Errorf("actions are not merged: %+v", p)
+	}
+	if !p.published("name") || !p.published("price") || p.published("secret") {
+		t.Errorf("columns = %v, want union of column lists", p.columns)
+	}
+	if want := []string{"(published = true)", "(price > 0)"}; !reflect.DeepEqual(p.rowFilters, want) {
+		t.Errorf("rowFilters = %v, want %v", p.rowFilters, want)
+	}
+
+	p.add("c", false, false, true, false, false, nil, "")
+	if !p.published("secret") || p.rowFilters != nil {
+		t.Errorf("publication without column list and row filter should publish everything: %+v", p)
+	}
+	if want := []string{"a", "b", "c"}; !reflect.DeepEqual(p.publications, want) {
+		t.Errorf("publications = %v, want %v", p.publications, want)
+	}
+}
@@ -0,0 +1,21 @@
+-- Query for discovering publication options of published tables.
+-- $1 is an array of publication names.
+-- $2 and $3 (optional) limit discovery to single schema and table.
+-- Columns, which are missing in older versions, are read via to_jsonb, and are NULL there.
+SELECT
+	pt.schemaname,
+	pt.tablename,
+	p.pubname,
+	p.pubinsert,
+	p.pubupdate,
+	p.pubdelete,
+	COALESCE((to_jsonb(p)->>'pubtruncate')::bool, false) AS pubtruncate, -- PG11+
+	COALESCE((to_jsonb(p)->>'pubviaroot')::bool, false) AS pubviaroot, -- PG13+
+	to_jsonb(pt)->'attnames' AS columns, -- PG15+ column list
+	to_jsonb(pt)->>'rowfilter' AS row_filter -- PG15+ row filter
+FROM pg_publication AS p
+	INNER JOIN pg_publication_tables AS pt ON pt.pubname = p.pubname
+WHERE p.pubname = ANY($1::text[])
+  AND ($2::text IS NULL OR pt.schemaname = $2)
+  AND ($3::text IS NULL OR pt.tablename = $3)
+ORDER BY pt.schemaname, pt.tablename, p.pubname;
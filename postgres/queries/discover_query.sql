@@ -1,11 +1,13 @@
 -- Query for discovering tables to be indexed by OpenSearch.
--- $1 is the name of the publication.
+-- $1 is an array of publication names.
+-- $2 and $3 (optional) limit discovery to single schema and table.
+-- Partitions are configured by comments of their root table, since they are published by their own name (without publish_via_partition_root).
 SELECT 
 	s.nspname, -- namespace/schema
 	t.relname, -- table 
 	a.attname, -- column
-	obj_description(concat(s.nspname, '.', t.relname)::regclass::oid) as table_comment,
-	col_description(concat(s.nspname, '.', t.relname)::regclass::oid, a.attnum) as column_comment,
+	obj_description(COALESCE(root.oid, t.oid), 'pg_class') as table_comment,
+	col_description(COALESCE(root.oid, t.oid), COALESCE(ra.attnum, a.attnum)) as column_comment,
 	COALESCE(i.indisprimary, false) as pk, -- is column part of PK
 	a.atttypid as typ_oid,
 	CASE -- check which columns are stored in WAL for update/delete operations
@@ -13,9 +15,12 @@ SELECT
 		WHEN t.relreplident = 'd' THEN COALESCE(i.indisprimary, false) -- default: primary key if any
 		WHEN t.relreplident = 'i' THEN COALESCE(i.indisreplident, false) -- indice: columns of uniq index
 		WHEN t.relreplident = 'f' THEN true -- full: all columns
-	END saved_in_wal
+	END saved_in_wal,
+	a.attnum, -- column order, used for composite keys
+	root.relname AS root_table, -- root of partition, if any
+	t.relkind = 'p' AS partitioned -- root of partitions, published via root
 	--  a.attrelid as relation_oid -- table type (check if same as in streaming protocol)
-FROM pg_publication_tables AS pt
+FROM (SELECT DISTINCT schemaname, tablename FROM pg_publication_tables WHERE pubname = ANY($1::text[])) AS pt
 	INNER JOIN pg_namespace s ON  pt.schemaname = s.nspname
 	INNER JOIN pg_class t ON  pt.tablename = t.relname AND t.relnamespace = s.oid
 	INNER JOIN pg_attribute a ON a.attrelid = t.oid
@@ -33,12 +38,23 @@ FROM pg_publication_tables AS pt
 		WHERE i.indisprimary OR i.indisreplident -- We are interested in PK and WAL fields only
 		GROUP BY i.indrelid, attnum
 	) i ON a.attnum = i.attnum AND a.attrelid = i.indrelid
-WHERE pt.pubname=$1
+	LEFT JOIN LATERAL ( -- top most ancestor of partition
+		WITH RECURSIVE ancestors AS (
+			SELECT inh.inhparent AS oid, 1 AS depth FROM pg_inherits AS inh WHERE inh.inhrelid = t.oid AND t.relispartition
+			UNION ALL
+			SELECT inh.inhparent, anc.depth + 1 FROM pg_inherits AS inh INNER JOIN ancestors AS anc ON inh.inhrelid = anc.oid
+		)
+		SELECT c.oid, c.relname FROM ancestors INNER JOIN pg_class AS c ON c.oid = ancestors.oid ORDER BY depth DESC LIMIT 1
+	) root ON true
+	LEFT JOIN pg_attribute ra ON ra.attrelid = root.oid AND ra.attname = a.attname -- same column of root; attnum may differ
+WHERE
   -- negative numbers are reserved for system columns.
-  AND a.attnum > 0 
+  a.attnum > 0 
   AND NOT a.attisdropped 
   -- only [r]ealations and [p]artitions. [m]aterialized_views and other types are not supported by PG.
   AND t.relkind IN ('r', 'p')
   -- skip system tables
   AND s.nspname NOT IN ('information_schema', 'pg_catalog', 'pg_toast') 
+  AND ($2::text IS NULL OR s.nspname = $2)
+  AND ($3::text IS NULL OR t.relname = $3)
 ORDER BY s.nspname, t.relname, a.attnum;
@@ -1,10 +1,10 @@
 -- Query for periodical check of WAL lag. 
--- Returns LSN positions and size of WAL, blocked from GC by this slot.
+-- Returns size of WAL, blocked from GC by this slot, and slot state.
+-- Slot state is returned as json, since set of columns depends on Postgres version.
+-- `wal_status` and `safe_wal_size` are available in PG13+. If status is 'lost', we need reindex everything.
 -- $1 is a slot name
 SELECT 
-    pg_current_wal_lsn()::TEXT AS current_lsn, 
-    confirmed_flush_lsn::TEXT AS flushed_lsn, 
-    pg_size_pretty(pg_current_wal_lsn() - confirmed_flush_lsn) AS size,
-    pg_replication_slots.wal_status -- if 'lost', we need reindex everything
-FROM pg_replication_slots
+    (pg_current_wal_lsn() - confirmed_flush_lsn)::int8 AS lag,
+    to_json(s)::text AS slot
+FROM pg_replication_slots AS s
 WHERE slot_name=$1;
@@ -27,12 +27,14 @@ func init() {
 // Selects all rown from table, and populates results into Database.results chanel.
 // Copy existing data snapshoted by slot creation, using simple protocol.
 func (t *Table) CopyAll(ctx context.Context, conn *pgconn.PgConn) error {
-	t.init()
+	if err := t.init(); err != nil {
+		return err
+	}
 
 	// XXX: ctx.WithDeadline here can lead to deadlock.
 
 	q := t.copyQuery()
-	t.logger.Info("COPYing snapshot", zap.String("sql", q))
+	t.logger.Info("COPYing snapshot", zap.String("sql", q), zap.String("target", t.targetName()))
 
 	pipeReader, pipeWriter := io.Pipe()
 	wg := &sync.WaitGroup{}
@@ -41,10 +43,12 @@ func (t *Table) CopyAll(ctx context.Context, conn *pgconn.PgConn) error {
 	defer wg.Wait()
 
 	parser := pgcopy.NewParser()
+	defer parser.Close() // unblock parser, if rows are not read till the end
 	go func() {
 		defer wg.Done()
+		defer pipeReader.Close() // unblock COPY, if parser stopped earlier
 		err := parser.Parse(pipeReader)
-		if err != nil {
+		if err != nil && err != pgcopy.ErrClosed {
 			t.logger.Error("parser error", zap.Error(err))
 		}
 	}()
@@ -63,6 +67,9 @@ func (t *Table) CopyAll(ctx context.Context, conn *pgconn.PgConn) error {
 	stream := t.schema.database.stream // shortcut
 
 	for {
+		if err := t.schema.database.waitSlotHealthy(ctx); err != nil {
+			return err
+		}
 		row, err := parser.Next(ctx)
 		if err == io.EOF {
 			return nil
@@ -78,7 +85,7 @@ func (t *Table) CopyAll(ctx context.Context, conn *pgconn.PgConn) error {
 		}
 
 		if t.index {
-			meta, _ := t.elasticBulkHeader(ESIndex)
+			meta, _ := t.elasticBulkHeader(t.insertAction())
 			data, _ := t.MarshalJSON()
 			stream.add(Document{Meta: meta, Data: data})
 		}
@@ -92,6 +99,9 @@ func (t *Table) CopyAll(ctx context.Context, conn *pgconn.PgConn) error {
 
 // Select everything and push (streaming) it into elasticsearch.
 func (db *Database) Reindex(ctx context.Context) error {
+	if health, reason := db.SlotHealth(); health == HealthCritical {
+		db.logger.Warn("replication slot health is critical; reindex is not paused, since slot advances after it", zap.String("reason", reason))
+	}
 	for _, table := range db.indexableTables() {
 		if err := table.CopyAll(ctx, db.replConn); err != nil {
 			return err
@@ -0,0 +1,241 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// reloadPrefix of logical message, which requests config reload. E.G: emitted by event trigger on COMMENT.
+const reloadPrefix = "pg2es.reload"
+
+// ErrReloadBusy is returned when too many reloads are pending
+var ErrReloadBusy = errors.New("reload is already pending")
+
+// ReloadReport describes changes of configuration, applied by reload.
+type ReloadReport struct {
+	Added    []string `json:"added,omitempty"`    // tables
+	Removed  []string `json:"removed,omitempty"`  // tables
+	Changed  []string `json:"changed,omitempty"`  // tables
+	Backfill []string `json:"backfill,omitempty"` // tables, which need reindex to pick up new fields or documents
+	Error    string   `json:"error,omitempty"`
+}
+
+type reloadRequest struct {
+	done chan ReloadReport
+}
+
+// RequestReload asks replication to re-read configuration from comments. Reload is applied between transactions.
+// Returned channel receives report, once reload is applied.
+func (db *Database) RequestReload() <-chan ReloadReport {
+	done := make(chan ReloadReport, 1)
+	select {
+	case db.reloads <- reloadRequest{done: done}:
+	default:
+		done <- ReloadReport{Error: ErrReloadBusy.Error()}
+	}
+	return done
+}
+
+// applyReloads applies pending reload requests at once. Should be called from replication goroutine, outside of transaction.
+func (db *Database) applyReloads(ctx context.Context) {
+	var pending []reloadRequest
+	for {
+		select {
+		case req := <-db.reloads:
+			pending = append(pending, req)
+			continue
+		default:
+		}
+		break
+	}
+	if len(pending) == 0 {
+		return
+	}
+
+	report, err := db.reload(ctx)
+	if err != nil {
+		db.logger.Error("config reload failed; keeping current config", zap.Error(err))
+		report.Error = err.Error()
+	} else {
+		db.logger.Info("config reloaded",
+			zap.Strings("added", report.Added),
+			zap.Strings("removed", report.Removed),
+			zap.Strings("changed", report.Changed),
+			zap.Strings("backfill", report.Backfill),
+		)
+		var added []string // to publication
+		for _, name := range report.Backfill {
+			if i := sort.SearchStrings(report.Added, name); i < len(report.Added) && report.Added[i] == name {
+				added = append(added, name)
+			}
+		}
+		db.startBackfill(ctx, added)
+	}
+	for _, req := range pending {
+		req.done <- report
+	}
+}
+
+// reload discovers configuration into fresh tree, carries over replication state (relation IDs and column positions), and swaps it.
+func (db *Database) reload(ctx context.Context) (report ReloadReport, err error) {
+	old, oldFile := db.schemas, db.fileConfig
+	restore := func() { db.schemas, db.fileConfig = old, oldFile }
+	oldSummary := db.configSummary()
+
+	db.schemas = make(map[string]*Schema)
+	if err := db.Discover(ctx); err != nil {
+		restore()
+		return report, err
+	}
+
+	relations := db.carryOver(old)
+	for _, schema := range db.schemas {
+		for _, table := range schema.tables {
+			if err := table.init(); err != nil {
+				restore()
+				return report, err
+			}
+		}
+	}
+	if err := db.ValidateJoins(); err != nil {
+		restore()
+		return report, err
+	}
+	db.keepRemoved(relations)
+	db.relationSet = relations
+
+	newSummary := db.configSummary()
+	for name, lines := range newSummary {
+		oldLines, ok := oldSummary[name]
+		switch {
+		case !ok:
+			report.Added = append(report.Added, name)
+			if lines[0] == "index=true" {
+				report.Backfill = append(report.Backfill, name)
+			}
+		case strings.Join(lines, "\n") != strings.Join(oldLines, "\n"):
+			report.Changed = append(report.Changed, name)
+			if lines[0] == "index=true" && !containsAll(oldLines, lines) { // new fields, documents or keys
+				report.Backfill = append(report.Backfill, name)
+			}
+		}
+	}
+	for name := range oldSummary {
+		if _, ok := newSummary[name]; !ok {
+			report.Removed = append(report.Removed, name)
+		}
+	}
+	sort.Strings(report.Added)
+	sort.Strings(report.Removed)
+	sort.Strings(report.Changed)
+	sort.Strings(report.Backfill)
+	return report, nil
+}
+
+// carryOver copies replication state (relation IDs and column positions) of old tables into discovered ones, and returns relations by ID.
+func (db *Database) carryOver(old map[string]*Schema) map[uint32]*Table {
+	relations := make(map[uint32]*Table)
+	for _, oldSchema := range old {
+		for _, oldTable := range oldSchema.tables {
+			schema, ok := db.schemas[oldSchema.name]
+			if !ok {
+				continue
+			}
+			table, ok := schema.tables[oldTable.name]
+			if !ok {
+				continue
+			}
+			table.relID = oldTable.relID
+			if table.relID != 0 {
+				relations[table.relID] = table
+			}
+			for name, oldCol := range oldTable.columns {
+				if col, ok := table.columns[name]; ok {
+					col.pos = oldCol.pos
+				}
+			}
+		}
+	}
+	return relations
+}
+
+// keepRemoved keeps known relations, which are not discovered anymore, as ignored ones.
+// pgoutput still streams their changes, written before removal from publication.
+// Relation is replaced, once it's added back, and RelationMessage is received.
+func (db *Database) keepRemoved(relations map[uint32]*Table) {
+	for id, table := range db.relationSet {
+		if _, ok := relations[id]; !ok {
+			table.removed = true
+			relations[id] = table
+		}
+	}
+}
+
+// configSummary describes effective config of each table (`schema.table`) as sorted lines. First line is `index=bool`.
+func (db *Database) configSummary() map[string][]string {
+	summary := make(map[string][]string)
+	for _, schema := range db.schemas {
+		for _, t := range schema.tables {
+			lines := []string{
+				"docType=" + t.docType,
+				"target=" + t.targetName(),
+				"pk=" + strings.Join(t.pkCols.names(), ","),
+				"pksep=" + t.pkSep,
+				"join=" + strconv.FormatBool(t.join.enabled) + "," + t.join.fieldName + "," + t.join.typeName,
+				"appendOnly=" + strconv.FormatBool(t.appendOnly),
+				"delete=" + t.delete.mode,
+				"history=" + t.historyIndex,
+				"nulls=" + strconv.FormatBool(t.keepNulls),
+			}
+			if t.routingCol != nil {
+				lines = append(lines, "routing="+t.routingCol.name)
+			}
+			for _, rt := range t.templates() {
+				lines = append(lines, "template="+rt.src)
+			}
+			if t.filter != nil {
+				lines = append(lines, "filter="+t.filter.src)
+			}
+			if t.partition != nil {
+				lines = append(lines, "partition="+t.partition.name+","+t.partition.layout)
+			}
+			for _, mf := range t.meta {
+				lines = append(lines, "meta="+mf.name+"="+mf.key)
+			}
+			for _, col := range t.columns {
+				if col.index {
+					lines = append(lines, "column="+col.name+"->"+col.fieldName)
+				}
+			}
+			for _, inl := range t.inlines {
+				lines = append(lines, fmt.Sprintf("inline=%s,%s,%s,%s", inl.name, inl.fieldName, inl.source.name, strings.Join(inl.parentCols.names(), ",")))
+				for name, col := range inl.columns {
+					lines = append(lines, "inline="+inl.name+"."+col.name+"->"+name)
+				}
+			}
+			sort.Strings(lines)
+			summary[schema.name+"."+t.name] = append([]string{"index=" + strconv.FormatBool(t.index)}, lines...)
+		}
+	}
+	return summary
+}
+
+// containsAll tells whether every line of b is in a
+func containsAll(a, b []string) bool {
+	set := make(map[string]bool, len(a))
+	for _, line := range a {
+		set[line] = true
+	}
+	for _, line := range b {
+		if !set[line] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,46 @@
+package postgres
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jackc/pglogrepl"
+	"go.uber.org/zap"
+)
+
+func TestReloadKeepsRemovedRelations(t *testing.T) {
+	db := New(nil, zap.NewNop())
+	for name, id := range map[string]uint32{"orders": 10, "items": 11} {
+		table := db.schema("public").table(name)
+		table.SetRelationID(id)
+		db.relationSet[id] = table
+	}
+
+	// reload: items is removed from publication
+	old := db.schemas
+	db.schemas = make(map[string]*Schema)
+	db.schema("public").table("orders")
+	relations := db.carryOver(old)
+	db.keepRemoved(relations)
+	db.relationSet = relations
+
+	if got := db.relation(10); got == nil || got.removed || got != db.schemas["public"].tables["orders"] {
+		t.Errorf("relation 10 = %+v, want discovered orders", got)
+	}
+	if got := db.relation(11); got == nil || !got.removed {
+		t.Errorf("relation 11 = %+v, want removed items", got)
+	}
+
+	// changes, written before removal, are still streamed
+	tuple := &pglogrepl.TupleData{Columns: []*pglogrepl.TupleDataColumn{{DataType: pglogrepl.TupleDataTypeText, Data: []byte("1")}}}
+	for _, msg := range []pglogrepl.Message{
+		&pglogrepl.InsertMessage{RelationID: 11, Tuple: tuple},
+		&pglogrepl.UpdateMessage{RelationID: 11, NewTuple: tuple},
+		&pglogrepl.DeleteMessage{RelationID: 11, OldTuple: tuple},
+		&pglogrepl.InsertMessage{RelationID: 12, Tuple: tuple}, // never known
+	} {
+		if err := db.HandleLogical(context.Background(), 1, msg); err != nil {
+			t.Errorf("HandleLogical(%T) error = %v", msg, err)
+		}
+	}
+}
@@ -25,10 +25,15 @@ var (
 		Name: "streaming_messages",
 		Help: "Wall decoded messages received in streaming replication",
 	}, []string{"operation", "table"})
+	metricIgnoredMessages = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "streaming_messages_ignored",
+		Help: "Changes, which are not forwarded due to table config (append only, delete strategy), or since table is removed from publication",
+	}, []string{"operation", "table"})
 )
 
 func init() {
 	prometheus.MustRegister(metricMessages)
+	prometheus.MustRegister(metricIgnoredMessages)
 }
 
 func pgconnConfig() (*pgconn.Config, error) {
@@ -72,22 +77,28 @@ func (db *Database) Connect(ctx context.Context) error {
 	db.version = db.replConn.ParameterStatus("server_version")
 
 	// check if Binary decoding is possible (PG14+)
-	major, err := strconv.Atoi(strings.Split(db.version, ".")[0])
+	db.major, err = strconv.Atoi(strings.Split(db.version, ".")[0])
 	if err != nil {
 		db.logger.Warn("can not parse Postgres major version", zap.String("postgres_version", db.version))
 	}
-	db.useBinary = major >= 14
+	db.useBinary = db.major >= 14
 
 	db.logger.Info("Connected to Database", zap.String("postgres_version", db.version), zap.Bool("binary_streaming", db.useBinary))
 	return nil
 }
 
+// Close terminates both connections. Leader lock (if any) is released as well.
 func (db *Database) Close(ctx context.Context) error {
 	db.queryConnMu.Lock()
-	db.queryConn.Close(ctx)
+	qErr := db.queryConn.Close(ctx)
 	db.queryConnMu.Unlock()
 
-	db.replConn.Close(ctx)
+	if err := db.replConn.Close(ctx); err != nil {
+		return fmt.Errorf("close replication connection: %w", err)
+	}
+	if qErr != nil {
+		return fmt.Errorf("close query connection: %w", qErr)
+	}
 	return nil
 }
 
@@ -97,18 +108,21 @@ func (db *Database) Close(ctx context.Context) error {
 // db.CreateReplicationSlot(ctx)
 // ... copy data
 // db.Commit(ctx)
-func (db *Database) CreateReplicationSlot(ctx context.Context) {
+func (db *Database) CreateReplicationSlot(ctx context.Context) error {
 	opts := pglogrepl.CreateReplicationSlotOptions{
 		Temporary:      false,
 		SnapshotAction: "USE_SNAPSHOT",
 		Mode:           pglogrepl.LogicalReplication,
 	}
-	_, err := pglogrepl.CreateReplicationSlot(ctx, db.replConn, db.SlotName, outputPlugin, opts)
+	res, err := pglogrepl.CreateReplicationSlot(ctx, db.replConn, db.SlotName, outputPlugin, opts)
 	if err != nil {
-		db.logger.Error("failed to create replication slot", zap.String("slot", db.SlotName), zap.Error(err))
-		return
+		return fmt.Errorf("create replication slot %s: %w", db.SlotName, err)
 	}
-	db.logger.Info("created replication slot", zap.String("slot", db.SlotName))
+	db.logger.Info("created replication slot", zap.String("slot", db.SlotName), zap.String("consistent_point", res.ConsistentPoint))
+	if db.snapshotLSN, err = pglogrepl.ParseLSN(res.ConsistentPoint); err != nil {
+		return fmt.Errorf("parse slot consistent point: %w", err)
+	}
+	return nil
 }
 
 func (db *Database) Tx(ctx context.Context) error {
@@ -119,12 +133,13 @@ func (db *Database) Commit(ctx context.Context) error {
 	return db.replConn.Exec(ctx, "COMMIT").Close()
 }
 
-func (db *Database) DropReplicationSlot(ctx context.Context) {
+func (db *Database) DropReplicationSlot(ctx context.Context) error {
 	opts := pglogrepl.DropReplicationSlotOptions{Wait: true} // true?
 	if err := pglogrepl.DropReplicationSlot(ctx, db.replConn, db.SlotName, opts); err != nil {
-		db.logger.Error("failed to drop replication slot", zap.String("slot", db.SlotName), zap.Error(err))
+		return fmt.Errorf("drop replication slot %s: %w", db.SlotName, err)
 	}
 	db.logger.Info("dropped replication slot", zap.String("slot", db.SlotName))
+	return nil
 }
 
 // StartReplication switches replConn into `CopyBoth` mode and starts streaming.
@@ -135,12 +150,15 @@ func (db *Database) DropReplicationSlot(ctx context.Context) {
 // See: https://stackoverflow.com/questions/71016200/proper-standby-status-update-in-streaming-replication-protocol
 func (db *Database) StartReplication(ctx context.Context, at pglogrepl.LSN) error {
 	pluginArguments := []string{
-		"proto_version '1'",                          // next protocol versions are not required for our use case.
-		"publication_names '" + db.Publication + "'", // TODO: escape pgPublication; support multiple publications
+		"proto_version '1'", // next protocol versions are not required for our use case.
+		"publication_names " + publicationNames(db.Publications),
 	}
 	if db.useBinary { // Binary streaming for PG14+
 		pluginArguments = append(pluginArguments, "binary 'true'")
 	}
+	if db.major >= 14 { // Logical messages for PG14+; heartbeats and reload requests
+		pluginArguments = append(pluginArguments, "messages 'true'")
+	}
 
 	opts := pglogrepl.StartReplicationOptions{PluginArgs: pluginArguments}
 	if err := pglogrepl.StartReplication(ctx, db.replConn, db.SlotName, at, opts); err != nil {
@@ -148,11 +166,15 @@ func (db *Database) StartReplication(ctx context.Context, at pglogrepl.LSN) erro
 	}
 
 	standbyDeadline := time.Now().Add(db.StandbyTimeout)
+	db.streaming = true
 	db.logger.Info("Started streaming replication")
 
 	prevCommit := db.stream.Position()
 	for {
 		// TODO: exit on <- ctx.Done()
+		if !db.inTx {
+			db.applyReloads(ctx)
+		}
 		if time.Now().After(standbyDeadline) {
 			commit := db.stream.Position()
 			status := pglogrepl.StandbyStatusUpdate{WALWritePosition: commit}
@@ -176,15 +198,9 @@ func (db *Database) StartReplication(ctx context.Context, at pglogrepl.LSN) erro
 			if pgconn.Timeout(err) {
 				select {
 				case <-ctx.Done():
+					// Final position is acknowledged after search engine confirms all pending documents. See Acknowledge.
 					db.logger.Info("shutdown: streaming stopped")
-					if commit := db.stream.Position(); commit > prevCommit {
-						status := pglogrepl.StandbyStatusUpdate{WALWritePosition: commit}
-						ctxWithTimeout, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-						defer cancel()
-						err := pglogrepl.SendStandbyStatusUpdate(ctxWithTimeout, db.replConn, status)
-						db.logger.Debug("shutdown: committed latest position", zap.String("lsn", commit.String()), zap.Error(err))
-					}
-
+					db.backfills.Wait()
 					return nil // graceful exit
 				default: // non blocking continue
 				}
@@ -212,12 +228,16 @@ func (db *Database) StartReplication(ctx context.Context, at pglogrepl.LSN) erro
 				if err != nil {
 					db.logger.Fatal("failed to parse XLogData", zap.Error(err))
 				}
-				logicalMsg, err := pglogrepl.Parse(xld.WALData)
+				logicalMsg, err := parseLogical(xld.WALData)
 				if err != nil {
 					db.logger.Fatal("failed to parse replication message from XLogData", zap.Error(err))
 				}
 				// check xld.ServerWALEnd instead xld.WALStart
-				db.HandleLogical(ctx, xld.WALStart, logicalMsg) // TODO: make it non-blocking for standby
+				// TODO: make it non-blocking for standby
+				if err := db.HandleLogical(ctx, xld.WALStart, logicalMsg); err != nil {
+					// position is not confirmed past failed change; it's streamed again after restart
+					return fmt.Errorf("handle %T at %s: %w", logicalMsg, xld.WALStart, err)
+				}
 			}
 		default:
 			db.logger.Fatal("received unexpected message", zap.String("type", fmt.Sprintf("%T", msg)))
@@ -226,6 +246,21 @@ func (db *Database) StartReplication(ctx context.Context, at pglogrepl.LSN) erro
 	}
 }
 
+// Acknowledge sends final standby status with the latest position, confirmed by search engine.
+// Should be called during shutdown, after StartReplication returned and all documents are pushed.
+func (db *Database) Acknowledge(ctx context.Context) error {
+	if !db.streaming {
+		return nil // nothing to acknowledge
+	}
+	commit := db.stream.Position()
+	status := pglogrepl.StandbyStatusUpdate{WALWritePosition: commit}
+	if err := pglogrepl.SendStandbyStatusUpdate(ctx, db.replConn, status); err != nil {
+		return fmt.Errorf("send final standby status update: %w", err)
+	}
+	db.logger.Info("shutdown: committed latest position", zap.Stringer("lsn", commit))
+	return nil
+}
+
 // must is temporarily helper to fail in some places
 func must(data []byte, err error) []byte {
 	if err != nil {
@@ -234,25 +269,72 @@ func must(data []byte, err error) []byte {
 	return data
 }
 
+// transaction describes currently decoded transaction
+type transaction struct {
+	xid        uint32
+	finalLSN   pglogrepl.LSN
+	commitTime time.Time
+	changes    int // ordinal number of the current insert, update or delete
+}
+
+// versionTypeExternalGTE allows same version, thus replays are idempotent
+const versionTypeExternalGTE = "external_gte"
+
+// documentVersion returns external version of current change: commit LSN of transaction, or slot snapshot LSN during reindex.
+func (db *Database) documentVersion() (uint64, string) {
+	if !db.ExternalVersion {
+		return 0, ""
+	}
+	if db.tx.finalLSN != 0 {
+		return uint64(db.tx.finalLSN), versionTypeExternalGTE
+	}
+	if db.snapshotLSN != 0 {
+		return uint64(db.snapshotLSN), versionTypeExternalGTE
+	}
+	return 0, ""
+}
+
 func (db *Database) HandleLogical(ctx context.Context, lsn pglogrepl.LSN, msg pglogrepl.Message) error {
 	pos := Position(lsn)
 	switch v := msg.(type) {
 	case *pglogrepl.BeginMessage:
+		db.tx = transaction{xid: v.Xid, finalLSN: v.FinalLSN, commitTime: v.CommitTime}
+		db.inTx = true
 	case *pglogrepl.CommitMessage:
 		// Nice to have some lock, to have whole transaction in single ES batch
-		// d.results <- Document{LSN: lsn}
+		// Position without documents advances slot, even if nothing indexable was changed in this transaction.
+		db.stream.add(Position(v.TransactionEndLSN))
+		db.slotMonitor.trackCommit(v.TransactionEndLSN, v.CommitTime)
+		db.inTx = false
+
+	case *LogicalDecodingMessage:
+		if sentAt, ok := heartbeatMessageTime(db.SlotName, v.Content); ok && v.Prefix == heartbeatPrefix {
+			db.heartbeatReceived(sentAt)
+		}
+		if v.Prefix == reloadPrefix {
+			db.logger.Info("config reload requested by logical message", zap.Stringer("lsn", lsn))
+			db.RequestReload() // applied after commit
+		}
 
 	// This message is delivered at the beginning, and after table schema changes.
-	// TODO: support dropped columns
+	// Columns are reconciled: new ones are discovered, vanished ones are removed.
 	case *pglogrepl.RelationMessage:
+		_, known := db.schema(v.Namespace).tables[v.RelationName]
 		table := db.schema(v.Namespace).table(v.RelationName)
 		table.SetRelationID(v.RelationID)
+		db.relationSet[v.RelationID] = table // table might be renamed
 		metricMessages.WithLabelValues("metadata", table.name).Inc()
+		if err := db.reconcileRelation(ctx, table, v); err != nil {
+			return err
+		}
 
 		for pos, relcol := range v.Columns {
 			col := table.Column(relcol.Name)
 			// ... relcol.Flags&1 != 0  means PK
 			col.pos = pos
+			if col.num == 0 { // not discovered; columns are sent in table order
+				col.num = pos + 1
+			}
 
 			dataType, err := db.dataTypeDecoder(relcol.DataType)
 			if err != nil {
@@ -260,15 +342,44 @@ func (db *Database) HandleLogical(ctx context.Context, lsn pglogrepl.LSN, msg pg
 			}
 			col.setTyp(dataType)
 		}
-		table.init() // field names
+		// field names; config may become invalid, E.G: if dropped column was required
+		err := table.init()
+		if errors.Is(err, ErrInvalidConfig) {
+			table.logger.Error("table config is invalid after schema change; table is not indexed", zap.Error(err))
+			table.index, table.isInlinedIn = false, nil
+			err = table.init()
+		}
+		if err != nil {
+			return err
+		}
+		if !known { // added to publication at runtime
+			table.logger.Info("table added to publication", zap.Uint32("relation_id", v.RelationID))
+			if table.index || len(table.isInlinedIn) > 0 {
+				db.startBackfill(ctx, []string{table.schema.name + "." + table.name})
+			}
+		}
 
 	case *pglogrepl.InsertMessage:
-		table := db.relation(v.RelationID)
+		table := db.changedRelation(v.RelationID, "insert")
+		if table == nil {
+			return nil
+		}
 		metricMessages.WithLabelValues("insert", table.name).Inc()
+		db.tx.changes++
+		if table.heartbeat {
+			if sentAt, ok := table.heartbeatTime(db.SlotName, v.Tuple); ok {
+				db.heartbeatReceived(sentAt)
+			}
+			return nil
+		}
+		db.history(pos, historyInsert, table, nil, v.Tuple)
 
 		table.decodeTuple(v.Tuple)
+		if !table.matchFilter() {
+			return nil
+		}
 		if table.index {
-			meta := must(table.elasticBulkHeader(ESIndex))
+			meta := must(table.elasticBulkHeader(table.insertAction()))
 			data := must(table.MarshalJSON())
 			db.stream.add(Document{Position: pos, Meta: meta, Data: data})
 		}
@@ -280,16 +391,35 @@ func (db *Database) HandleLogical(ctx context.Context, lsn pglogrepl.LSN, msg pg
 		}
 
 	case *pglogrepl.UpdateMessage:
-		table := db.relation(v.RelationID)
+		table := db.changedRelation(v.RelationID, "update")
+		if table == nil {
+			return nil
+		}
 		metricMessages.WithLabelValues("update", table.name).Inc()
+		db.tx.changes++
+		if table.heartbeat {
+			if sentAt, ok := table.heartbeatTime(db.SlotName, v.NewTuple); ok {
+				db.heartbeatReceived(sentAt)
+			}
+			return nil
+		}
+		db.history(pos, historyUpdate, table, v.OldTuple, v.NewTuple)
+		if table.appendOnly { // documents are immutable
+			table.ignore("update")
+			return nil
+		}
 
 		// IF document keys (_id, _routing) changed, we can't update it, thus it needs to be re-created.
 		insert := false
+		existed, known := true, false // whether old row matched filter, thus document exists
 		if !table.upsertOnly && v.OldTuple != nil {
 			table.decodeTuple(v.OldTuple)
+			if table.filter != nil && table.filter.columns.inWAL() {
+				existed, known = table.matchFilter(), true
+			}
 
 			// cleanup main document
-			if table.index && table.tupleKeysChanged(v.OldTuple, v.NewTuple) {
+			if existed && table.index && table.tupleKeysChanged(v.OldTuple, v.NewTuple) {
 				insert = true // new document would be inserted
 				// but we need to delete current document first
 				meta := must(table.elasticBulkHeader(ESDelete))
@@ -298,7 +428,7 @@ func (db *Database) HandleLogical(ctx context.Context, lsn pglogrepl.LSN, msg pg
 
 			// Clean up old inlines
 			for _, inl := range table.isInlinedIn {
-				if inl.tupleKeysChanged(v.OldTuple, v.NewTuple) {
+				if existed && inl.tupleKeysChanged(v.OldTuple, v.NewTuple) {
 					meta := must(inl.elasticBulkHeader(ESUpdate))
 					data := must(inl.jsonDelScript())
 					db.stream.add(Document{Position: pos, Meta: meta, Data: data})
@@ -307,12 +437,46 @@ func (db *Database) HandleLogical(ctx context.Context, lsn pglogrepl.LSN, msg pg
 		}
 
 		table.decodeTuple(v.NewTuple)
+		unknown := false                                                     // filter can not be evaluated; document keeps its current state
+		if table.filter != nil && table.filter.columns.toasted(v.NewTuple) { // unchanged TOAST is not NULL
+			db.fillUnchangedToast(ctx, table, v.OldTuple, v.NewTuple)
+			unknown = table.filter.columns.toasted(v.NewTuple) // not available; logged
+		}
+
+		if unknown && !existed {
+			return nil
+		} else if !unknown && !table.matchFilter() { // row does not match (anymore), remove document
+			if !existed {
+				return nil
+			}
+			if table.index && !insert { // otherwise already deleted
+				meta := must(table.elasticBulkHeader(ESDelete))
+				db.stream.add(Document{Position: pos, Meta: meta})
+			}
+			for _, inl := range table.isInlinedIn {
+				meta := must(inl.elasticBulkHeader(ESUpdate))
+				data := must(inl.jsonDelScript())
+				db.stream.add(Document{Position: pos, Meta: meta, Data: data})
+			}
+			return nil
+		}
 
 		if table.index {
 			if insert { // create new document, since we deleted previous
-				meta := must(table.elasticBulkHeader(ESInsert))
+				db.fillUnchangedToast(ctx, table, v.OldTuple, v.NewTuple)
+				meta := must(table.elasticBulkHeader(ESIndex)) // might be another index, if target is templated
+				data := must(table.MarshalJSON())
+				db.stream.add(Document{Position: pos, Meta: meta, Data: data})
+			} else if db.isCopying(table) { // backfill might not have written document yet; partial update would be lost
+				db.fillUnchangedToast(ctx, table, v.OldTuple, v.NewTuple)
+				meta := must(table.elasticBulkHeader(ESIndex)) // versioned, or copied row is created only
 				data := must(table.MarshalJSON())
 				db.stream.add(Document{Position: pos, Meta: meta, Data: data})
+			} else if table.filter != nil && !(known && existed) && !unknown { // document might not exist, since row did not match before
+				db.fillUnchangedToast(ctx, table, v.OldTuple, v.NewTuple)
+				meta := must(table.elasticBulkHeader(ESUpdate))
+				data := must(table.EncodeUpsertRowJSON())
+				db.stream.add(Document{Position: pos, Meta: meta, Data: data})
 			} else { // update existing
 				// XXX: ESUpdate is correct here, and would work fine assuming that data is consistent.
 				meta := must(table.elasticBulkHeader(ESUpdate))
@@ -321,6 +485,9 @@ func (db *Database) HandleLogical(ctx context.Context, lsn pglogrepl.LSN, msg pg
 			}
 		}
 
+		if len(table.isInlinedIn) > 0 { // inlined object is replaced as a whole
+			db.fillUnchangedToast(ctx, table, v.OldTuple, v.NewTuple)
+		}
 		for _, inl := range table.isInlinedIn {
 			meta := must(inl.elasticBulkHeader(ESUpdate))
 			data := must(inl.jsonAddScript())
@@ -328,13 +495,31 @@ func (db *Database) HandleLogical(ctx context.Context, lsn pglogrepl.LSN, msg pg
 		}
 
 	case *pglogrepl.DeleteMessage:
-		table := db.relation(v.RelationID)
+		table := db.changedRelation(v.RelationID, "delete")
+		if table == nil {
+			return nil
+		}
 		metricMessages.WithLabelValues("delete", table.name).Inc()
+		db.tx.changes++
+		db.history(pos, historyDelete, table, v.OldTuple, nil)
+		if table.appendOnly || table.delete.mode == DeleteIgnore { // documents are kept as is
+			table.ignore("delete")
+			return nil
+		}
 		table.decodeTuple(v.OldTuple)
+		if table.filter != nil && table.filter.columns.inWAL() && !table.matchFilter() {
+			return nil // document does not exist
+		}
 
 		if table.index && !table.upsertOnly {
-			meta := must(table.elasticBulkHeader(ESDelete))
-			db.stream.add(Document{Position: pos, Meta: meta})
+			if table.delete.mode == DeleteSoft {
+				meta := must(table.elasticBulkHeader(ESUpdate))
+				data := must(table.EncodeSoftDeleteJSON())
+				db.stream.add(Document{Position: pos, Meta: meta, Data: data})
+			} else {
+				meta := must(table.elasticBulkHeader(ESDelete))
+				db.stream.add(Document{Position: pos, Meta: meta})
+			}
 		}
 
 		for _, inl := range table.isInlinedIn {
@@ -342,7 +527,12 @@ func (db *Database) HandleLogical(ctx context.Context, lsn pglogrepl.LSN, msg pg
 				continue
 			}
 			meta := must(inl.elasticBulkHeader(ESUpdate))
-			data := must(inl.jsonDelScript())
+			var data []byte
+			if table.delete.mode == DeleteSoft {
+				data = must(inl.jsonSoftDelScript())
+			} else {
+				data = must(inl.jsonDelScript())
+			}
 			db.stream.add(Document{Position: pos, Meta: meta, Data: data})
 		}
 
@@ -0,0 +1,144 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pglogrepl"
+	"go.uber.org/zap"
+)
+
+// reconcileRelation syncs table columns with RelationMessage, which is sent before the first change of a table
+// and after each schema change. New columns (including renamed ones) are discovered to read their config from comments,
+// while vanished (dropped or renamed) columns are removed.
+func (db *Database) reconcileRelation(ctx context.Context, table *Table, rel *pglogrepl.RelationMessage) error {
+	names := make(map[string]bool, len(rel.Columns))
+	var added []string
+	for _, relcol := range rel.Columns {
+		names[relcol.Name] = true
+		if _, ok := table.columns[relcol.Name]; !ok {
+			added = append(added, relcol.Name)
+		}
+	}
+
+	var removed []*Column
+	for name, col := range table.columns {
+		if !names[name] {
+			removed = append(removed, col)
+		}
+	}
+
+	if len(added) > 0 {
+		err := db.DiscoverTable(ctx, table.schema.name, table.name)
+		if errors.Is(err, ErrInvalidConfig) { // logged by discovery; replication goes on
+			err = nil
+		}
+		if err != nil {
+			return fmt.Errorf("rediscover table %s: %w", table.name, err)
+		}
+	}
+	if len(added) == 0 && len(removed) == 0 {
+		return nil
+	}
+
+	// renamed column keeps attnum, and comment (config) with it
+	renamed := make(map[string]string)
+	for _, col := range removed {
+		for _, name := range added {
+			if newCol, ok := table.columns[name]; ok && newCol.num == col.num {
+				renamed[col.name] = name
+			}
+		}
+		table.removeColumn(col)
+	}
+
+	table.logger.Info("schema change",
+		zap.Uint32("relation_id", rel.RelationID),
+		zap.Strings("added", added),
+		zap.Strings("removed", columnNames(removed)),
+		zap.Any("renamed", renamed),
+	)
+	return nil
+}
+
+// removeColumn forgets column, and all references to it.
+// Features, configured by dropped column, are disabled, so replication goes on.
+func (t *Table) removeColumn(col *Column) {
+	delete(t.columns, col.name)
+
+	column := zap.String("column", col.name)
+	for i, name := range t.pkNames {
+		if name == col.name {
+			t.pkNames = append(t.pkNames[:i:i], t.pkNames[i+1:]...)
+			t.logger.Error("PK column is dropped; document IDs are built from the rest of PK", column)
+			break
+		}
+	}
+	if t.timestampName == col.name {
+		t.timestampName = ""
+		t.logger.Error("timestamp column is dropped; @timestamp is not set", column)
+	}
+	if t.partition != nil && t.partition.name == col.name {
+		t.partition = nil
+		t.logger.Error("partition column is dropped; documents are written into base index", column)
+	}
+	if t.filter != nil && containsString(t.filter.fields, col.name) {
+		t.filter = nil
+		t.index = false
+		t.logger.Error("filter column is dropped; table is not indexed", column)
+	}
+
+	t.pkCols.remove(col)
+	if t.routingCol == col {
+		t.routingCol = nil
+	}
+	if t.join.nameCol == col {
+		t.join.nameCol = nil
+	}
+	if t.join.parentCol == col {
+		t.join.parentCol = nil
+	}
+	if t.timestampCol == col {
+		t.timestampCol = nil
+	}
+	if t.partition != nil && t.partition.col == col {
+		t.partition.col = nil
+	}
+	for _, rt := range t.templates() {
+		rt.columns.remove(col)
+	}
+	if t.filter != nil {
+		t.filter.columns.remove(col)
+	}
+
+	for _, inl := range t.isInlinedIn {
+		for name, icol := range inl.columns {
+			if icol == col {
+				delete(inl.columns, name)
+			}
+		}
+		inl.pkCols.remove(col)
+		inl.parentCols.remove(col)
+		if inl.routingCol == col {
+			inl.routingCol = nil
+		}
+	}
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func columnNames(columns []*Column) []string {
+	names := make([]string, len(columns))
+	for i, col := range columns {
+		names[i] = col.name
+	}
+	return names
+}
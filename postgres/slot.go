@@ -0,0 +1,125 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pglogrepl"
+	"go.uber.org/zap"
+)
+
+var (
+	// ErrSlotNotFound replication slot does not exist
+	ErrSlotNotFound = errors.New("replication slot does not exist")
+	// ErrSlotInUse replication slot is streamed by another process
+	ErrSlotInUse = errors.New("replication slot is active in another process")
+	// ErrSlotMismatch replication slot exists, but can not be used by this replica (different plugin, type or database)
+	ErrSlotMismatch = errors.New("replication slot can not be used")
+)
+
+// SlotStatus is a row of `pg_replication_slots` view.
+// Some fields are available only in recent Postgres versions, and are left empty otherwise.
+// See: https://www.postgresql.org/docs/current/view-pg-replication-slots.html
+type SlotStatus struct {
+	Name        string `json:"slot_name"`
+	Plugin      string `json:"plugin"`
+	SlotType    string `json:"slot_type"`
+	Database    string `json:"database"`
+	Active      bool   `json:"active"`
+	ActivePID   uint32 `json:"active_pid"`
+	ConfirmedAt string `json:"confirmed_flush_lsn"`
+	WALStatus   string `json:"wal_status"`          // PG13+: reserved, extended, unreserved or lost
+	SafeWALSize *int64 `json:"safe_wal_size"`       // PG13+: bytes which can be written before slot is in danger of being lost
+	Invalidated string `json:"invalidation_reason"` // PG17+: reason of slot invalidation if any
+	Conflicting bool   `json:"conflicting"`         // PG16+: slot is invalidated due to conflict with recovery
+}
+
+// Lost tells that slot does not hold all required WAL anymore, and streaming from it would result in data gap.
+func (s *SlotStatus) Lost() bool {
+	return s.WALStatus == "lost" || s.Invalidated != "" || s.Conflicting
+}
+
+// ConfirmedLSN returns last position acknowledged by replica
+func (s *SlotStatus) ConfirmedLSN() pglogrepl.LSN {
+	lsn, _ := pglogrepl.ParseLSN(s.ConfirmedAt)
+	return lsn
+}
+
+// DropSlot drops replication slot by query connection, which is usable, even if replication connection is not. E.G: after interrupted reindex.
+func (db *Database) DropSlot(ctx context.Context) error {
+	db.queryConnMu.Lock()
+	res := db.queryConn.ExecParams(ctx, `SELECT pg_drop_replication_slot($1)`, [][]byte{[]byte(db.SlotName)}, nil, nil, nil).Read()
+	db.queryConnMu.Unlock()
+	if res.Err != nil {
+		return fmt.Errorf("drop replication slot %s: %w", db.SlotName, res.Err)
+	}
+	db.logger.Info("dropped replication slot", zap.String("slot", db.SlotName))
+	return nil
+}
+
+// slotStatusQuery uses json representation of the row, since set of columns depends on Postgres version
+const slotStatusQuery = `SELECT to_json(s)::text FROM pg_replication_slots AS s WHERE slot_name=$1`
+
+// SlotStatus fetches current state of replication slot. ErrSlotNotFound is returned if there is no such slot.
+func (db *Database) SlotStatus(ctx context.Context) (*SlotStatus, error) {
+	db.queryConnMu.Lock()
+	res := db.queryConn.ExecParams(
+		ctx, slotStatusQuery,
+		[][]byte{[]byte(db.SlotName)}, nil, nil,
+		[]int16{textT},
+	).Read()
+	db.queryConnMu.Unlock()
+
+	if res.Err != nil {
+		return nil, fmt.Errorf("get slot status: %w", res.Err)
+	}
+	if len(res.Rows) == 0 {
+		return nil, ErrSlotNotFound
+	}
+
+	status := &SlotStatus{}
+	if err := json.Unmarshal(res.Rows[0][0], status); err != nil {
+		return nil, fmt.Errorf("decode slot status: %w", err)
+	}
+	return status, nil
+}
+
+// CheckSlot validates that existing replication slot can be safely used for streaming by this replica.
+// Lost slots are not considered as an error here, check SlotStatus.Lost() instead.
+func (db *Database) CheckSlot(ctx context.Context) (*SlotStatus, error) {
+	status, err := db.SlotStatus(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	logger := db.logger.With(
+		zap.String("slot", status.Name),
+		zap.String("plugin", status.Plugin),
+		zap.String("database", status.Database),
+		zap.Bool("active", status.Active),
+		zap.Uint32("active_pid", status.ActivePID),
+		zap.String("wal_status", status.WALStatus),
+		zap.Int64p("safe_wal_size", status.SafeWALSize),
+	)
+	logger.Info("found replication slot")
+
+	if status.SlotType != "" && status.SlotType != "logical" {
+		return status, fmt.Errorf("%w: slot type is %q, logical expected", ErrSlotMismatch, status.SlotType)
+	}
+	if status.Plugin != outputPlugin {
+		return status, fmt.Errorf("%w: plugin is %q, %q expected", ErrSlotMismatch, status.Plugin, outputPlugin)
+	}
+	if status.Database != db.name {
+		return status, fmt.Errorf("%w: slot belongs to %q database", ErrSlotMismatch, status.Database)
+	}
+	if status.Active && status.ActivePID != db.replConn.PID() {
+		return status, fmt.Errorf("%w: pid %d", ErrSlotInUse, status.ActivePID)
+	}
+	if status.Lost() {
+		logger.Warn("replication slot is lost; streaming from it would skip changes", zap.String("invalidation_reason", status.Invalidated))
+	}
+
+	return status, nil
+}
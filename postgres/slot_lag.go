@@ -2,38 +2,270 @@ package postgres
 
 import (
 	"context"
-	"math"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	_ "embed"
 
+	"github.com/jackc/pglogrepl"
 	"github.com/jackc/pgtype"
 	"github.com/prometheus/client_golang/prometheus"
 	"go.uber.org/zap"
 )
 
-func (db *Database) RegisterSlotLagMetric(ctx context.Context) {
-	metricSlotLag := prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+var (
+	metricSlotLag = prometheus.NewGauge(prometheus.GaugeOpts{
 		Name: "slot_lag",
 		Help: "how much bytes do we need to read, to keep up with current DB state",
-	}, func() (lag float64) {
-		timeout, cancel := context.WithTimeout(ctx, 10*time.Second)
-		defer cancel()
-		db.queryConnMu.Lock()
-		res := db.queryConn.ExecParams(timeout, `
-			SELECT pg_current_wal_lsn() - confirmed_flush_lsn AS lag
-			FROM pg_replication_slots WHERE slot_name=$1;
-		`, [][]byte{[]byte(db.SlotName)}, nil, nil, []int16{binT}).Read()
-		db.queryConnMu.Unlock()
-		if res.Err != nil || len(res.Rows) == 0 {
-			db.logger.Warn("slot lag metrics error", zap.Error(res.Err))
-			return math.NaN()
-		}
-		db.connInfo.Scan(pgtype.NumericOID, binT, res.Rows[0][0], &lag)
-		// db.logger.Info("slot lag", zap.Float64("lag", lag))
-
-		return lag
 	})
+	metricSlotLagSeconds = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "slot_lag_seconds",
+		Help: "age of the oldest commit, which is not yet acknowledged by replica",
+	})
+	metricSlotSafeWALSize = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "slot_safe_wal_size",
+		Help: "bytes, that can be written to WAL before slot is in danger of being lost (PG13+)",
+	})
+	metricSlotWALStatus = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "slot_wal_status",
+		Help: "current wal_status of replication slot (PG13+)",
+	}, []string{"status"})
+	metricSlotHealth = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "slot_health",
+		Help: "0 - ok, 1 - warning, 2 - critical",
+	})
+)
 
+func init() {
 	prometheus.MustRegister(metricSlotLag)
+	prometheus.MustRegister(metricSlotLagSeconds)
+	prometheus.MustRegister(metricSlotSafeWALSize)
+	prometheus.MustRegister(metricSlotWALStatus)
+	prometheus.MustRegister(metricSlotHealth)
+}
+
+// Health of replication slot
+type Health int32
+
+const (
+	HealthOK Health = iota
+	HealthWarning
+	HealthCritical
+)
+
+func (h Health) String() string {
+	switch h {
+	case HealthOK:
+		return "ok"
+	case HealthWarning:
+		return "warning"
+	case HealthCritical:
+		return "critical"
+	}
+	return "unknown"
+}
+
+// SlotMonitorOpts configures slot health thresholds. Zero value disables specific threshold.
+type SlotMonitorOpts struct {
+	Interval time.Duration
+
+	LagWarn     int64 // bytes
+	LagCritical int64 // bytes
+
+	LagTimeWarn     time.Duration
+	LagTimeCritical time.Duration
+
+	SafeWALWarn     int64 // minimal remaining bytes
+	SafeWALCritical int64 // minimal remaining bytes
+
+	PauseReindex bool // pause online backfill, while slot health is critical
+}
+
+// slotMonitor keeps latest known slot health and commits, which are not yet acknowledged.
+type slotMonitor struct {
+	health Health       // atomic
+	reason atomic.Value // string
+
+	mu      sync.Mutex
+	commits []commitTime // unacknowledged commits; ordered by LSN
+	acked   time.Time    // commit time of the latest acknowledged commit
+}
+
+type commitTime struct {
+	lsn pglogrepl.LSN
+	at  time.Time
+}
+
+// maxTrackedCommits limits memory, in case if search engine is not available for a long time.
+const maxTrackedCommits = 4096
+
+// trackCommit remembers commit timestamp, to calculate time lag.
+func (m *slotMonitor) trackCommit(lsn pglogrepl.LSN, at time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.commits) >= maxTrackedCommits {
+		m.commits[len(m.commits)-1] = commitTime{lsn: lsn, at: m.commits[len(m.commits)-1].at} // keep oldest timestamp
+		return
+	}
+	m.commits = append(m.commits, commitTime{lsn: lsn, at: at})
+}
+
+// timeLag returns age of the oldest unacknowledged commit.
+// If all received commits are acknowledged, but replica is still behind, age of latest acknowledged commit is used as an upper bound.
+func (m *slotMonitor) timeLag(confirmed pglogrepl.LSN, behind bool) time.Duration {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := 0
+	for ; i < len(m.commits) && m.commits[i].lsn <= confirmed; i++ {
+		m.acked = m.commits[i].at
+	}
+	m.commits = m.commits[i:]
+
+	switch {
+	case len(m.commits) > 0:
+		return time.Since(m.commits[0].at)
+	case behind && !m.acked.IsZero():
+		return time.Since(m.acked)
+	}
+	return 0
+}
+
+// check returns slot health and reason for the given state
+func (o *SlotMonitorOpts) check(lag int64, timeLag time.Duration, status *SlotStatus) (Health, string) {
+	switch {
+	case status.Lost():
+		return HealthCritical, "slot is lost: " + status.WALStatus + status.Invalidated
+	case o.LagCritical > 0 && lag >= o.LagCritical:
+		return HealthCritical, fmt.Sprintf("lag is %d bytes", lag)
+	case o.LagTimeCritical > 0 && timeLag >= o.LagTimeCritical:
+		return HealthCritical, fmt.Sprintf("lag is %s", timeLag)
+	case o.SafeWALCritical > 0 && status.SafeWALSize != nil && *status.SafeWALSize <= o.SafeWALCritical:
+		return HealthCritical, fmt.Sprintf("safe_wal_size is %d bytes", *status.SafeWALSize)
+	case status.WALStatus == "unreserved":
+		return HealthWarning, "wal_status is unreserved; slot will be lost soon"
+	case o.LagWarn > 0 && lag >= o.LagWarn:
+		return HealthWarning, fmt.Sprintf("lag is %d bytes", lag)
+	case o.LagTimeWarn > 0 && timeLag >= o.LagTimeWarn:
+		return HealthWarning, fmt.Sprintf("lag is %s", timeLag)
+	case o.SafeWALWarn > 0 && status.SafeWALSize != nil && *status.SafeWALSize <= o.SafeWALWarn:
+		return HealthWarning, fmt.Sprintf("safe_wal_size is %d bytes", *status.SafeWALSize)
+	}
+	return HealthOK, ""
+}
+
+//go:embed queries/get_slot_lag.sql
+var querySlotLag string
+
+// MonitorSlot periodically checks slot lag and WAL retention, and updates health and metrics.
+// Thresholds are configured via Database.SlotMonitor. Blocks until context is canceled.
+func (db *Database) MonitorSlot(ctx context.Context) {
+	interval := db.SlotMonitor.Interval
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		db.checkSlot(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (db *Database) checkSlot(ctx context.Context) {
+	timeout, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	db.queryConnMu.Lock()
+	res := db.queryConn.ExecParams(timeout, querySlotLag,
+		[][]byte{[]byte(db.SlotName)}, nil, nil,
+		[]int16{binT, textT},
+	).Read()
+	db.queryConnMu.Unlock()
+	if res.Err != nil || len(res.Rows) == 0 {
+		db.logger.Warn("slot lag check error", zap.Error(res.Err), zap.Int("rows", len(res.Rows)))
+		return
+	}
+
+	var lag pgtype.Int8
+	status := &SlotStatus{}
+	lag.DecodeBinary(db.connInfo, res.Rows[0][0])
+	if err := json.Unmarshal(res.Rows[0][1], status); err != nil {
+		db.logger.Warn("slot lag check error", zap.Error(err))
+		return
+	}
+
+	timeLag := db.slotMonitor.timeLag(db.stream.Position(), lag.Int > 0)
+
+	metricSlotLag.Set(float64(lag.Int))
+	metricSlotLagSeconds.Set(timeLag.Seconds())
+	metricSlotWALStatus.Reset()
+	if status.WALStatus != "" {
+		metricSlotWALStatus.WithLabelValues(status.WALStatus).Set(1)
+	}
+	if status.SafeWALSize != nil {
+		metricSlotSafeWALSize.Set(float64(*status.SafeWALSize))
+	}
+
+	health, reason := db.SlotMonitor.check(lag.Int, timeLag, status)
+	metricSlotHealth.Set(float64(health))
+	db.slotMonitor.reason.Store(reason)
+	prev := Health(atomic.SwapInt32((*int32)(&db.slotMonitor.health), int32(health)))
+	if prev == health {
+		return
+	}
+
+	logger := db.logger.With(
+		zap.String("slot", db.SlotName),
+		zap.Stringer("health", health),
+		zap.String("reason", reason),
+		zap.Int64("lag", lag.Int),
+		zap.Duration("lag_time", timeLag),
+		zap.String("wal_status", status.WALStatus),
+		zap.Int64p("safe_wal_size", status.SafeWALSize),
+	)
+	switch health {
+	case HealthCritical:
+		logger.Error("replication slot is in critical state; primary may run out of disk")
+	case HealthWarning:
+		logger.Warn("replication slot health degraded")
+	default:
+		logger.Info("replication slot health recovered")
+	}
+}
+
+// SlotHealth returns latest known health of replication slot, and reason of degradation if any.
+func (db *Database) SlotHealth() (Health, string) {
+	health := Health(atomic.LoadInt32((*int32)(&db.slotMonitor.health)))
+	reason, _ := db.slotMonitor.reason.Load().(string)
+	return health, reason
+}
+
+// waitSlotHealthy blocks online backfill while slot health is critical, if PauseReindex is configured.
+// Initial reindex is never paused: it runs before streaming, so slot can not advance until it's finished.
+func (db *Database) waitSlotHealthy(ctx context.Context) error {
+	if !db.backfilling || db.parent == nil || !db.SlotMonitor.PauseReindex {
+		return nil
+	}
+	for logged := false; ; logged = true {
+		health, reason := db.parent.SlotHealth()
+		if health != HealthCritical {
+			return nil
+		}
+		if !logged {
+			db.logger.Warn("backfill is paused, due to replication slot health", zap.String("reason", reason))
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Second):
+		}
+	}
 }
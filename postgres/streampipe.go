@@ -17,9 +17,10 @@ var (
 type StreamPipe struct {
 	ch  chan Doc
 	pos pglogrepl.LSN
-	ctx context.Context
+	ctx context.Context // aborts stream; documents are dropped
 }
 
+// NewStreamPipe creates a pipe. Canceling ctx aborts the stream, use Close for graceful shutdown instead.
 func NewStreamPipe(ctx context.Context) *StreamPipe {
 	return &StreamPipe{
 		ctx: ctx,
@@ -27,6 +28,7 @@ func NewStreamPipe(ctx context.Context) *StreamPipe {
 	}
 }
 
+// add blocks until document is accepted by consumer. Documents are dropped only if stream is aborted.
 func (p *StreamPipe) add(d Doc) {
 	select {
 	case p.ch <- d:
@@ -35,6 +37,12 @@ func (p *StreamPipe) add(d Doc) {
 	}
 }
 
+// Close stops the stream. Consumer receives ErrChClosed once all pending documents are read.
+// Must be called once, after all producers (replication, reindexing) are stopped.
+func (p *StreamPipe) Close() {
+	close(p.ch)
+}
+
 func (p *StreamPipe) Position() pglogrepl.LSN {
 	return pglogrepl.LSN(atomic.LoadUint64((*uint64)(&p.pos)))
 }
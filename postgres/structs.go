@@ -16,6 +16,9 @@ type bulkHeader struct {
 	Index   string `json:"_index"`
 	ID      string `json:"_id,omitempty"`
 	Routing string `json:"routing,omitempty"`
+
+	Version     uint64 `json:"version,omitempty"`
+	VersionType string `json:"version_type,omitempty"`
 }
 
 // MarshalJSON supports json.Marshaler interface
@@ -32,21 +35,44 @@ func (v bulkHeader) MarshalEasyJSON(w *jwriter.Writer) {
 	w.String(string(v.Action))
 	w.RawString(`:{`)
 
-	// required _index and _id fields
+	// required _index field
 	w.RawString(`"_index":`)
 	w.String(v.Index)
-	w.RawString(`,"_id":`)
-	w.String(v.ID)
+
+	// omitted _id is generated by search engine (append only tables)
+	if v.ID != "" {
+		w.RawString(`,"_id":`)
+		w.String(v.ID)
+	}
 
 	// omitempty optional field
 	if v.Routing != "" {
 		w.RawString(`,"routing":`)
 		w.String(v.Routing)
 	}
+	if v.Version != 0 {
+		w.RawString(`,"version":`)
+		w.Uint64(v.Version)
+		w.RawString(`,"version_type":`)
+		w.String(v.VersionType)
+	}
 
 	w.RawString(`}}`)
 }
 
+// timestampField is required by data streams
+const timestampField = "@timestamp"
+
+// renamedColumn puts column value under another key
+type renamedColumn struct {
+	*Column
+	key string
+}
+
+func (rc renamedColumn) jsonKey() string {
+	return rc.key
+}
+
 type stringKV struct {
 	key   string
 	value string
@@ -69,10 +95,15 @@ type jsonOmitter interface {
 	Omit() bool
 }
 
+type jsonNuller interface {
+	Null() bool
+}
+
 // document represents json document, that would be sent to search.
 // attempts to split table config from data.
 type document struct {
-	fields []jsonKV // table fields
+	fields    []jsonKV // table fields
+	keepNulls bool     // write NULLs as `null`, instead of omitting them
 }
 
 // MarshalJSON supports json.Marshaler interface
@@ -92,6 +123,9 @@ func (v document) MarshalEasyJSON(out *jwriter.Writer) {
 		if m, ok := col.(jsonOmitter); ok && m.Omit() {
 			continue
 		}
+		if m, ok := col.(jsonNuller); ok && m.Null() && !v.keepNulls {
+			continue
+		}
 
 		if comma {
 			out.RawByte(',')
@@ -3,10 +3,20 @@ package postgres
 import (
 	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/pg2es/search-replica/conftags"
 )
 
+// Known tag names of table and column config
+var (
+	tableTagNames = map[string]bool{
+		"index": true, "pk": true, "pksep": true, "inline": true, "join": true, "timestamp": true, "partition": true,
+		"filter": true, "nulls": true, "meta": true, "history": true, "delete": true, "id": true, "routing": true, "target": true,
+	}
+	columnTagNames = map[string]bool{"index": true, "inline": true, "join": true}
+)
+
 func (t *Table) parseStructTag(tag string) error {
 	if t.tagParsed {
 		return nil
@@ -19,8 +29,101 @@ func (t *Table) parseStructTag(tag string) error {
 	}
 
 	t.parseIndexTag(tags)
+	t.parsePKTags(tags)
 	t.parseInlineTags(tags)
 	t.parseJoinTag(tags)
+	if tag := tags.Get("timestamp"); tag != nil && tag.Values[0] != "" {
+		t.timestampName = tag.Values[0]
+	}
+	if err := t.parsePartitionTag(tags); err != nil {
+		return err
+	}
+	if err := t.parseFilterTag(tags); err != nil {
+		return err
+	}
+	if tag := tags.Get("nulls"); tag != nil {
+		switch tag.Values[0] {
+		case "keep":
+			t.keepNulls = true
+		case "omit", "":
+			t.keepNulls = false
+		default:
+			return fmt.Errorf("table %s: unknown nulls option %q", t.name, tag.Values[0])
+		}
+	}
+	if tag := tags.Get("meta"); tag != nil {
+		if t.meta, err = parseMetaFields(tag.Values); err != nil {
+			return fmt.Errorf("table %s: %w", t.name, err)
+		}
+	}
+	if tag := tags.Get("history"); tag != nil {
+		name := tag.Values[0]
+		if name == "" {
+			name = t.configName() + "-changes"
+		}
+		if t.historyIndex, err = sanitizeIndexName(name); err != nil {
+			return fmt.Errorf("table %s history: %w", t.name, err)
+		}
+	}
+	if tag := tags.Get("delete"); tag != nil {
+		if t.delete, err = parseDeleteStrategy(tag.Values); err != nil {
+			return fmt.Errorf("table %s: %w", t.name, err)
+		}
+	}
+	return t.parseTemplateTags(tags)
+}
+
+// parseFilterTag parses row predicate. E.G: `filter:"published = true AND deleted_at IS NULL"`
+func (t *Table) parseFilterTag(tags conftags.Tags) (err error) {
+	tag := tags.Get("filter")
+	if tag == nil {
+		return nil
+	}
+	if t.filter, err = parseRowFilter(strings.Join(tag.Values, ",")); err != nil {
+		return fmt.Errorf("table %s: %w", t.name, err)
+	}
+	return nil
+}
+
+// parsePartitionTag parses time based indices config. E.G: `partition:"created_at,daily"`
+func (t *Table) parsePartitionTag(tags conftags.Tags) (err error) {
+	tag := tags.Get("partition")
+	if tag == nil {
+		return nil
+	}
+	if t.partition, err = parseTimePartition(tag.Values); err != nil {
+		return fmt.Errorf("table %s: %w", t.name, err)
+	}
+	return nil
+}
+
+// parseTemplateTags parses per row templates of document address. E.G: `id:"{{.tenant}}:{{.id}}" routing:"{{.tenant}}" target:"docs-{{.tenant}}"`
+// Template may contain commas, so values are joined back.
+func (t *Table) parseTemplateTags(tags conftags.Tags) (err error) {
+	for name, rt := range map[string]**rowTemplate{
+		"id":      &t.idTmpl,
+		"routing": &t.routingTmpl,
+		"target":  &t.targetTmpl,
+	} {
+		tag := tags.Get(name)
+		if tag == nil {
+			continue
+		}
+		if *rt, err = parseRowTemplate(name, strings.Join(tag.Values, ",")); err != nil {
+			return fmt.Errorf("table %s: %w", t.name, err)
+		}
+	}
+	return nil
+}
+
+// parsePKTags parses explicit order of composite PK `pk:"tenant_id,id"` and separator of values in `_id` `pksep:":"`.
+func (t *Table) parsePKTags(tags conftags.Tags) error {
+	if tag := tags.Get("pk"); tag != nil && tag.Values[0] != "" {
+		t.pkNames = tag.Values
+	}
+	if tag := tags.Get("pksep"); tag != nil && tag.Values[0] != "" {
+		t.pkSep = tag.Values[0]
+	}
 	return nil
 }
 
@@ -90,6 +193,10 @@ func (t *Table) parseIndexTag(tags conftags.Tags) error {
 		switch opt {
 		case "all":
 			t.indexAll = true
+		case "append":
+			t.appendOnly = true
+		case "autoid":
+			t.autoID = true
 		}
 	}
 	return nil
@@ -102,13 +209,19 @@ func (c *Column) parseStructTag(tag string) error {
 	}
 
 	c.parseIndexTag(tags)
-	c.parseInlineTags(tags)
+	if err := c.parseInlineTags(tags); err != nil {
+		return fmt.Errorf("column %s: %w", c.name, err)
+	}
 	c.parseJoinTag(tags)
 	return nil
 }
 
 func (col *Column) parseInlineTags(tags conftags.Tags) error {
 	for _, tag := range tags.Filter("inline") {
+		// each partition would be a separate source, while inline has only one
+		if col.table.partitionOf != "" || col.table.partitioned {
+			return fmt.Errorf("partitioned table %s can not be inline source", col.table.configName())
+		}
 		inline := col.table.schema.inline(tag.Values[0])
 
 		// cross links
@@ -125,18 +238,23 @@ func (col *Column) parseInlineTags(tags conftags.Tags) error {
 		for _, opt := range tag.Values[1:] {
 			switch opt {
 			case "pk":
-				inline.pkCol = col
+				inline.pkCols.add(col)
 			case "parent":
-				inline.parentCol = col
+				inline.parentCols.add(col)
 			case "routing":
 				inline.routingCol = col
-			default: // field name
-				name = opt
+			default:
+				if ref := strings.TrimPrefix(opt, "parent="); ref != opt { // referenced parent PK column
+					inline.parentCols.add(col)
+					inline.parentRefs[col.name] = ref
+					continue
+				}
+				name = opt // field name
 				// log.Print("renaming fields is not suported yet.")
 			}
 		}
 		// XXX: Here we can detect 1:1 mapping, and use different inject script. Like following
-		// if inline.pkCol == inline.parentCol {
+		// if inline.pkCols == inline.parentCols {
 		// inline.scriptAddID = "injectone"
 		// inline.scriptAddID = "ejectone"
 		// }
@@ -165,7 +283,7 @@ func (col *Column) parseIndexTag(tags conftags.Tags) error {
 			col.table.pkNoPrefix = true
 			fallthrough
 		case "pk":
-			col.table.pkCol = col
+			col.table.pkCols.add(col)
 		case "routing":
 			col.table.routingCol = col
 		}
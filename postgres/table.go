@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"strings"
 
 	"github.com/jackc/pglogrepl"
@@ -14,6 +15,8 @@ import (
 var (
 	// ErrColumnOutOfRange means that received result tuple is smaller than expected column position
 	ErrColumnOutOfRange = errors.New("column out of range")
+	// ErrInvalidConfig table or column config can not be applied
+	ErrInvalidConfig = errors.New("invalid config")
 )
 
 type Table struct {
@@ -32,10 +35,40 @@ type Table struct {
 	indexAll   bool // index all columns by default
 	upsertOnly bool // without old PKs / _routing in WAL, proper update & delete is impossible
 	tagParsed  bool
+	tag        string // effective conftags: comment merged with config file
+	heartbeat  bool   // replica's own heartbeat table. Never indexed
+	removed    bool   // removed from publication by reload; changes, written before removal, are ignored
 
-	pkCol      *Column // used in scripting and `_id`
-	pkNoPrefix bool    // use raw field instead of {table}_{pk}
-	routingCol *Column // value for `_routing`
+	partitionOf string // root table of partition. Config and document type are taken from it
+	partitioned bool   // root of partitions (published via root); can not be copied directly
+
+	publication *publishedTable // combined options of publications
+	unpublished map[string]bool // columns excluded by publication column list
+
+	pkCols     keyColumns // used in scripting and `_id`. Multiple columns for composite keys
+	pkNames    []string   // explicit order of composite key columns
+	pkSep      string     // separator of composite key values in `_id`
+	pkNoPrefix bool       // use raw field instead of {table}_{pk}
+	routingCol *Column    // value for `_routing`
+
+	// templates evaluated for each row. E.G: `id:"{{.tenant}}:{{.id}}"`
+	idTmpl      *rowTemplate // `_id`, instead of PK
+	routingTmpl *rowTemplate // `routing`, instead of routing column
+	targetTmpl  *rowTemplate // index name
+
+	partition *timePartition // time based indices. E.G: `partition:"created_at,monthly"`
+	filter    *rowFilter     // only matching rows are indexed. E.G: `filter:"published AND deleted_at IS NULL"`
+	delete    deleteStrategy // how deleted rows are reflected in index. E.G: `delete:"soft"`
+
+	keepNulls    bool        // write NULLs of new rows as `null`, instead of omitting them. `nulls:"keep"`
+	historyIndex string      // append only index of row changes. E.G: `history:"orders-changes"`
+	meta         []metaField // replication metadata in documents. E.G: `meta:"lsn,commit_time"`
+
+	// append only mode (`index:",append"`): inserts are created, while updates and deletes are ignored. Suitable for data streams.
+	appendOnly    bool
+	autoID        bool    // `_id` is generated by search engine. Enabled by `autoid` option or for tables without PK
+	timestampName string  // column, mapped to `@timestamp`. E.G: `timestamp:"created_at"`
+	timestampCol  *Column // resolved in init
 
 	join tableJoin
 
@@ -48,6 +81,23 @@ func (t *Table) Schema() *Schema {
 	return t.schema
 }
 
+// setPartitionOf configures partition by its root table: document type defaults to root name.
+func (t *Table) setPartitionOf(root string) {
+	t.partitionOf = root
+	if t.docType == t.name {
+		t.docType = root
+	}
+	t.logger = t.logger.With(zap.String("partition_of", root))
+}
+
+// configName is a name of table, which config is used. Root table for partitions.
+func (t *Table) configName() string {
+	if t.partitionOf != "" {
+		return t.partitionOf
+	}
+	return t.name
+}
+
 // TODO: take RelID set cache out of this tree config
 func (t *Table) SetRelationID(id uint32) {
 	t.relID = id
@@ -59,7 +109,8 @@ const (
 	ESInsert ESAction = "insert"
 	ESUpdate ESAction = "update"
 	ESDelete ESAction = "delete"
-	ESIndex  ESAction = "index" // Upsert
+	ESIndex  ESAction = "index"  // Upsert
+	ESCreate ESAction = "create" // Fails if document exists. Required by data streams
 )
 
 // tupleKeysChanged tells whether document needs to be recreated
@@ -68,10 +119,7 @@ func (t *Table) tupleKeysChanged(oldTuple, newTuple *pglogrepl.TupleData) bool {
 		return false
 	}
 
-	if !bytes.Equal(
-		oldTuple.Columns[t.pkCol.pos].Data,
-		newTuple.Columns[t.pkCol.pos].Data,
-	) {
+	if t.pkCols.changed(oldTuple, newTuple) {
 		return true
 	}
 
@@ -82,6 +130,20 @@ func (t *Table) tupleKeysChanged(oldTuple, newTuple *pglogrepl.TupleData) bool {
 		return true
 	}
 
+	if t.partition != nil && t.partition.col != nil && !bytes.Equal(
+		newTuple.Columns[t.partition.col.pos].Data,
+		oldTuple.Columns[t.partition.col.pos].Data,
+	) {
+		return true
+	}
+
+	// row moves to another index, if target depends on changed values. E.G: `target:"orders-{{.tenant_id}}"`
+	for _, rt := range []*rowTemplate{t.idTmpl, t.routingTmpl, t.targetTmpl} {
+		if rt != nil && rt.columns.changed(oldTuple, newTuple) {
+			return true
+		}
+	}
+
 	return false
 }
 
@@ -116,26 +178,62 @@ func (t *Table) decodeTuple(tuple *pglogrepl.TupleData) error {
 	return nil
 }
 
-func (t *Table) elasticBulkHeader(action ESAction) ([]byte, error) {
+func (t *Table) elasticBulkHeader(action ESAction) (_ []byte, err error) {
 	header := bulkHeader{
 		Action: action,
 		Index:  t.indexName,
-		ID:     t.pkCol.string(),
+		ID:     t.pkCols.string(t.pkSep),
 	}
 
 	if !t.pkNoPrefix { // add document type prefix to ID, to avoid collisions
-		header.ID = t.name + "_" + header.ID
+		header.ID = t.configName() + defaultKeySeparator + header.ID
+	}
+	if t.autoID {
+		header.ID = ""
+	}
+	if action == ESIndex || action == ESDelete { // updates and creates can not be versioned externally
+		header.Version, header.VersionType = t.schema.database.documentVersion()
 	}
 	if t.routingCol != nil {
 		header.Routing = t.routingCol.string()
 	}
 
+	if t.idTmpl == nil && t.routingTmpl == nil && !t.dynamicTarget() && t.partition == nil {
+		return json.Marshal(header)
+	}
+	data := t.templateData()
+	if t.idTmpl != nil { // raw value, without document type prefix
+		if header.ID, err = t.idTmpl.execute(data); err != nil {
+			return nil, err
+		}
+	}
+	if t.routingTmpl != nil {
+		if header.Routing, err = t.routingTmpl.execute(data); err != nil {
+			return nil, err
+		}
+	}
+	if t.dynamicTarget() {
+		if header.Index, err = t.targetTmpl.execute(data); err != nil {
+			return nil, err
+		}
+		if header.Index, err = sanitizeIndexName(header.Index); err != nil {
+			return nil, err
+		}
+	}
+	if t.partition != nil {
+		index, timeBased := t.partition.target(header.Index, t.partition.col, t)
+		header.Index = index
+		if timeBased && action != ESDelete {
+			t.schema.database.ensureIndex(index)
+		}
+	}
+
 	return json.Marshal(header)
 }
 
 func (t *Table) MarshalJSON() ([]byte, error) {
 	out := jwriter.Writer{}
-	t.jsonEncodeRow(&out)
+	t.jsonEncodeRow(&out, t.keepNulls)
 	return out.Buffer.BuildBytes(), out.Error
 }
 
@@ -144,14 +242,15 @@ func (t *Table) EncodeUpdateRowJSON() ([]byte, error) {
 	out := jwriter.Writer{}
 	out.RawString(`{"doc":`)
 
-	t.jsonEncodeRow(&out)
+	t.jsonEncodeRow(&out, true) // explicit nulls overwrite previous values
 
 	out.RawByte('}')
 	return out.Buffer.BuildBytes(), out.Error
 }
 
-func (t *Table) jsonEncodeRow(buf *jwriter.Writer) {
-	doc := document{}
+// jsonEncodeRow writes current row. Unchanged TOAST values are always omitted, while NULLs are omitted unless keepNulls.
+func (t *Table) jsonEncodeRow(buf *jwriter.Writer, keepNulls bool) {
+	doc := document{keepNulls: keepNulls}
 	for _, col := range t.columns { // add real columns
 		if col.index {
 			doc.fields = append(doc.fields, col)
@@ -160,43 +259,142 @@ func (t *Table) jsonEncodeRow(buf *jwriter.Writer) {
 	if t.join.enabled {
 		doc.fields = append(doc.fields, &t.join)
 	}
+	if t.timestampCol != nil {
+		doc.fields = append(doc.fields, renamedColumn{Column: t.timestampCol, key: timestampField})
+	}
 	doc.fields = append(doc.fields, stringKV{key: "docType", value: t.docType})
+	doc.fields = append(doc.fields, t.metaFields()...)
 
 	doc.MarshalEasyJSON(buf)
 }
 
+// EncodeUpsertRowJSON is same as EncodeUpdateRowJSON, but creates document if it does not exist
+func (t *Table) EncodeUpsertRowJSON() ([]byte, error) {
+	out := jwriter.Writer{}
+	out.RawString(`{"doc":`)
+
+	t.jsonEncodeRow(&out, true) // explicit nulls overwrite previous values
+
+	out.RawString(`,"doc_as_upsert":true}`)
+	return out.Buffer.BuildBytes(), out.Error
+}
+
+// matchFilter tells whether current row should be indexed. NULL and omitted (not in WAL, toasted) values are NULLs.
+func (t *Table) matchFilter() bool {
+	return t.filter.match(func(name string) interface{} {
+		col := t.columns[name]
+		if col == nil || col.value == nil || col.Omit() || col.Null() {
+			return nil
+		}
+		return col.value.Get()
+	})
+}
+
 // init: consistency checks and pre-encode caching
-func (t *Table) init() {
-	if t.pkCol == nil {
-		t.logger.Debug("PK is not configured. Fallback to implicit PK")
-		for _, col := range t.columns {
-			if col.sqlPK {
-				t.pkCol = col
-			}
+func (t *Table) init() error {
+	pkCols, err := t.primaryKey()
+	if err != nil {
+		return err
+	}
+	t.pkCols = pkCols
+
+	for _, rt := range t.templates() {
+		if unknown := rt.resolve(t); len(unknown) > 0 {
+			t.logger.Warn("template references unknown fields", zap.String("template", rt.src), zap.Strings("fields", unknown))
+		}
+	}
+
+	if t.filter != nil {
+		if unknown := t.filter.resolve(t); len(unknown) > 0 {
+			return t.configError("filter %q references unknown columns %v", t.filter.src, unknown)
 		}
 	}
 
 	for _, inl := range t.isInlinedIn {
-		inl.init()
+		if err := inl.init(); err != nil {
+			return err
+		}
 	}
 
 	if !t.index { // Skip checks & setup for ignored tables
-		return
+		return nil
 	}
 
-	if t.pkCol == nil {
-		t.logger.Fatal("Unknown PK")
+	if t.autoID && !t.appendOnly { // updates and deletes can not address documents without `_id`
+		return t.configError("autoid option requires append mode")
+	}
+	if t.appendOnly && len(t.pkCols) == 0 && t.idTmpl == nil {
+		t.autoID = true
+	}
+	if len(t.pkCols) == 0 && t.idTmpl == nil && !t.autoID {
+		return t.configError("unknown PK")
+	}
+	if t.timestampName != "" {
+		if t.timestampCol = t.columns[t.timestampName]; t.timestampCol == nil {
+			return t.configError("timestamp column %q does not exist", t.timestampName)
+		}
 	}
 
-	// TODO: Index name
 	t.indexName = t.schema.database.name
 	if t.schema.name != "public" {
 		t.indexName = t.schema.database.name + "_" + t.schema.name
 	}
+	if t.targetTmpl != nil && t.targetTmpl.static() { // per table index or alias. E.G: `target:"products_v2"`
+		name, err := t.targetTmpl.execute(t.templateMeta())
+		if err != nil || name == "" {
+			return t.configError("invalid target index %q: %v", t.targetTmpl.src, err)
+		}
+		t.indexName = name
+	}
 
-	if !t.pkCol.oldInWAL || (t.routingCol != nil && !t.routingCol.oldInWAL) {
+	if t.idTmpl == nil && !t.pkCols.inWAL() || (t.routingCol != nil && !t.routingCol.oldInWAL) {
 		t.upsertOnly = true
 	}
+	for _, rt := range t.templates() {
+		if !rt.columns.inWAL() {
+			t.upsertOnly = true
+		}
+	}
+	if t.partition != nil {
+		if t.partition.col = t.columns[t.partition.name]; t.partition.col == nil {
+			return t.configError("partition column %q does not exist", t.partition.name)
+		}
+		if !t.partition.col.oldInWAL {
+			t.upsertOnly = true
+		}
+	}
+	return nil
+}
+
+// primaryKey resolves document key: explicit order of composite key `pk:"tenant_id,id"`, columns tagged as `pk`, or SQL PK.
+// It does not depend on init, so inline can resolve PK of its parent.
+func (t *Table) primaryKey() (keyColumns, error) {
+	if len(t.pkNames) > 0 {
+		pkCols := make(keyColumns, 0, len(t.pkNames)) // backing array might be shared (E.G: implicit inline PK)
+		for _, name := range t.pkNames {
+			col, ok := t.columns[name]
+			if !ok {
+				return nil, t.configError("PK column %q does not exist", name)
+			}
+			pkCols = append(pkCols, col)
+		}
+		return pkCols, nil
+	}
+	if len(t.pkCols) > 0 {
+		return t.pkCols, nil
+	}
+	var pkCols keyColumns
+	for _, col := range t.columns {
+		if col.sqlPK {
+			pkCols.add(col)
+		}
+	}
+	return pkCols, nil
+}
+
+// configError wraps ErrInvalidConfig with table name
+func (t *Table) configError(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: table %s.%s: %s", ErrInvalidConfig, t.schema.name, t.name, fmt.Sprintf(format, args...))
 }
 
 // Column gets (existing or default) column config.
@@ -218,18 +416,38 @@ func (t *Table) Column(name string) (col *Column) {
 	return col
 }
 
+// insertAction returns bulk action for new rows.
+// Backfilled rows are indexed with version of COPY start, if external versions are used; otherwise they never overwrite streamed documents.
+func (t *Table) insertAction() ESAction {
+	db := t.schema.database
+	if t.appendOnly || (db.backfilling && !db.ExternalVersion) {
+		return ESCreate
+	}
+	return ESIndex
+}
+
+// ignore accounts update or delete, which is not forwarded according to table config (append only, delete strategy)
+func (t *Table) ignore(operation string) {
+	metricIgnoredMessages.WithLabelValues(operation, t.name).Inc()
+	t.logger.Debug("change is ignored by table config", zap.String("operation", operation))
+}
+
+// dynamicTarget tells whether index name depends on row values
+func (t *Table) dynamicTarget() bool {
+	return t.targetTmpl != nil && !t.targetTmpl.static()
+}
+
 // indexColumns lists columns that are used for indexing, including inlines and id/routing fields
 func (t *Table) indexColumns() (columns []*Column) {
 	for _, col := range t.columns {
-		if col.index {
+		if col.index || t.keyColumn(col) {
 			columns = append(columns, col)
+			continue
 		}
 		for _, inl := range t.isInlinedIn {
-			for _, icol := range inl.columns {
-				if col == icol {
-					columns = append(columns, col)
-					break
-				}
+			if inl.keyColumn(col) {
+				columns = append(columns, col)
+				break
 			}
 		}
 	}
@@ -237,16 +455,48 @@ func (t *Table) indexColumns() (columns []*Column) {
 	return
 }
 
+// keyColumn tells whether column is required to address the document: PK, routing, join or templates.
+func (t *Table) keyColumn(col *Column) bool {
+	if t.pkCols.contains(col) || t.routingCol == col || t.timestampCol == col {
+		return true
+	}
+	if t.partition != nil && t.partition.name == col.name {
+		return true
+	}
+	if t.filter != nil && t.filter.columns.contains(col) {
+		return true
+	}
+	if t.join.enabled && (t.join.nameCol == col || t.join.parentCol == col) {
+		return true
+	}
+	for _, rt := range t.templates() {
+		if rt.columns.contains(col) {
+			return true
+		}
+	}
+	return false
+}
+
 // copyQuery returns copy query suitable for initial data load.
 // E.G: COPY "foo" ("baz","baz") TO STDOUT WITH BINARY;
 func (t *Table) copyQuery() string {
 	var q strings.Builder
+	table := `"` + strings.ReplaceAll(t.schema.name, `"`, `""`) + `"."` + strings.ReplaceAll(t.name, `"`, `""`) + `"`
+	var where []string
+	if t.filter != nil {
+		where = append(where, t.filter.sql())
+	}
+	if t.publication != nil && len(t.publication.rowFilters) > 0 { // rows, which are published by any of publications
+		where = append(where, `(`+strings.Join(t.publication.rowFilters, ` OR `)+`)`)
+	}
+
 	q.WriteString(`COPY `)
-	q.WriteByte('"')
-	q.WriteString(strings.ReplaceAll(t.schema.name, `"`, `""`))
-	q.WriteString(`"."`)
-	q.WriteString(strings.ReplaceAll(t.name, `"`, `""`))
-	q.WriteString(`" (`)
+	if len(where) > 0 || t.partitioned { // COPY (SELECT ... WHERE ...) TO
+		q.WriteString(`(SELECT `)
+	} else {
+		q.WriteString(table)
+		q.WriteString(` (`)
+	}
 
 	for i, col := range t.indexColumns() {
 		if i != 0 {
@@ -258,6 +508,14 @@ func (t *Table) copyQuery() string {
 		q.WriteString(strings.ReplaceAll(col.name, `"`, `""`))
 		q.WriteByte('"')
 	}
+	if len(where) > 0 || t.partitioned {
+		q.WriteString(` FROM `)
+		q.WriteString(table) // includes all partitions
+	}
+	if len(where) > 0 {
+		q.WriteString(` WHERE `)
+		q.WriteString(strings.Join(where, ` AND `))
+	}
 	q.WriteByte(')')
 	q.WriteString(` TO STDOUT WITH BINARY;`)
 
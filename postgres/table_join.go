@@ -1,6 +1,9 @@
 package postgres
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"fmt"
+)
 
 // https://www.elastic.co/guide/en/elasticsearch/reference/current/parent-join.html
 type tableJoin struct {
@@ -31,3 +34,36 @@ func (tj *tableJoin) MarshalJSON() ([]byte, error) {
 
 	return json.Marshal(joinObj)
 }
+
+// targetName returns index (or alias) of table documents. For templated targets, template source is returned.
+func (t *Table) targetName() string {
+	if t.dynamicTarget() {
+		return t.targetTmpl.src
+	}
+	return t.indexName
+}
+
+// ValidateJoins checks that all parts of parent/child relation (tables sharing join field) are stored in the same index.
+// Tables have to be initialised.
+func (db *Database) ValidateJoins() error {
+	for _, schema := range db.schemas {
+		targets := make(map[string]*Table) // join field -> first table
+		for _, table := range schema.tables {
+			if !table.index || !table.join.enabled {
+				continue
+			}
+			first, ok := targets[table.join.fieldName]
+			if !ok {
+				targets[table.join.fieldName] = table
+				continue
+			}
+			if first.targetName() != table.targetName() {
+				return fmt.Errorf(
+					"join %q: tables %s and %s are in different indices %q and %q",
+					table.join.fieldName, first.name, table.name, first.targetName(), table.targetName(),
+				)
+			}
+		}
+	}
+	return nil
+}
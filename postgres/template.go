@@ -0,0 +1,211 @@
+package postgres
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"unicode"
+	"unicode/utf8"
+)
+
+// templateFuncs are available in `id`, `routing` and `target` templates
+var templateFuncs = template.FuncMap{
+	"lower":   strings.ToLower,
+	"upper":   strings.ToUpper,
+	"trim":    strings.TrimSpace,
+	"replace": strings.ReplaceAll,
+}
+
+// rowTemplate is a Go text/template, evaluated against decoded column values of each row.
+// E.G: `id:"{{.tenant}}:{{.id}}"`. Besides columns, following fields are available:
+// .database, .schema, .table, .docType, .index (default index name). Columns take precedence on name conflicts.
+type rowTemplate struct {
+	src     string
+	tmpl    *template.Template
+	fields  []string   // referenced fields (column or meta names)
+	columns keyColumns // referenced columns. Resolved in Table.init
+}
+
+func parseRowTemplate(name, src string) (*rowTemplate, error) {
+	tmpl, err := template.New(name).Funcs(templateFuncs).Option("missingkey=zero").Parse(src)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s template: %w", name, err)
+	}
+
+	rt := &rowTemplate{src: src, tmpl: tmpl}
+	seen := make(map[string]bool)
+	walkTemplateFields(tmpl.Tree.Root, func(field string) {
+		if !seen[field] {
+			seen[field] = true
+			rt.fields = append(rt.fields, field)
+		}
+	})
+	return rt, nil
+}
+
+// walkTemplateFields calls fn for each top level field, referenced by template. E.G: `.tenant` in `{{ .tenant | lower }}`
+func walkTemplateFields(node parse.Node, fn func(string)) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			walkTemplateFields(child, fn)
+		}
+	case *parse.ActionNode:
+		walkTemplateFields(n.Pipe, fn)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, cmd := range n.Cmds {
+			walkTemplateFields(cmd, fn)
+		}
+	case *parse.CommandNode:
+		for _, arg := range n.Args {
+			walkTemplateFields(arg, fn)
+		}
+	case *parse.FieldNode:
+		fn(n.Ident[0])
+	case *parse.ChainNode:
+		walkTemplateFields(n.Node, fn)
+	case *parse.IfNode:
+		walkTemplateFields(&n.BranchNode, fn)
+	case *parse.RangeNode:
+		walkTemplateFields(&n.BranchNode, fn)
+	case *parse.WithNode:
+		walkTemplateFields(&n.BranchNode, fn)
+	case *parse.BranchNode:
+		walkTemplateFields(n.Pipe, fn)
+		walkTemplateFields(n.List, fn)
+		walkTemplateFields(n.ElseList, fn)
+	case *parse.TemplateNode:
+		walkTemplateFields(n.Pipe, fn)
+	}
+}
+
+// resolve links referenced fields with table columns. Fields which are not columns should be meta fields.
+// Returns fields, which are neither columns nor meta fields.
+func (rt *rowTemplate) resolve(t *Table) (unknown []string) {
+	rt.columns = rt.columns[:0]
+	meta := t.templateMeta()
+	for _, field := range rt.fields {
+		if col, ok := t.columns[field]; ok {
+			rt.columns.add(col)
+		} else if _, ok := meta[field]; !ok {
+			unknown = append(unknown, field)
+		}
+	}
+	return unknown
+}
+
+// static tells that template does not depend on row values
+func (rt *rowTemplate) static() bool {
+	return len(rt.columns) == 0
+}
+
+// execute renders template with given data
+func (rt *rowTemplate) execute(data map[string]string) (string, error) {
+	var out strings.Builder
+	if err := rt.tmpl.Execute(&out, data); err != nil {
+		return "", fmt.Errorf("execute %s template: %w", rt.tmpl.Name(), err)
+	}
+	return out.String(), nil
+}
+
+// templateMeta returns meta fields, available in templates
+func (t *Table) templateMeta() map[string]string {
+	return map[string]string{
+		"database": t.schema.database.name,
+		"schema":   t.schema.name,
+		"table":    t.configName(),
+		"docType":  t.docType,
+		"index":    t.indexName,
+	}
+}
+
+// templateData returns meta fields and decoded values of table columns, which are used in templates.
+func (t *Table) templateData() map[string]string {
+	data := t.templateMeta()
+	for _, rt := range t.templates() {
+		for _, col := range rt.columns {
+			data[col.name] = col.string()
+		}
+	}
+	return data
+}
+
+// parentTemplateData returns template data for parent document of the inline.
+// Fields of parent templates are taken from source table row by name, while parent PK fields are taken from parent reference columns.
+func (i *Inline) parentTemplateData() map[string]string {
+	data := i.parent.templateMeta()
+	for _, col := range i.templateColumns() {
+		data[col.name] = col.string()
+	}
+	for n, col := range i.parentCols {
+		if n < len(i.parent.pkCols) {
+			data[i.parent.pkCols[n].name] = col.string()
+		}
+	}
+	return data
+}
+
+// templateColumns returns columns of source table, which are referenced by parent document templates.
+func (i *Inline) templateColumns() (columns keyColumns) {
+	for _, rt := range i.parent.templates() {
+		for _, field := range rt.fields {
+			if col, ok := i.source.columns[field]; ok {
+				columns.add(col)
+			}
+		}
+	}
+	if p := i.parent.partition; p != nil {
+		if col, ok := i.source.columns[p.name]; ok {
+			columns.add(col)
+		}
+	}
+	return columns
+}
+
+// templates returns all configured templates
+func (t *Table) templates() (list []*rowTemplate) {
+	for _, rt := range []*rowTemplate{t.idTmpl, t.routingTmpl, t.targetTmpl} {
+		if rt != nil {
+			list = append(list, rt)
+		}
+	}
+	return list
+}
+
+// maxIndexNameLen is limit of index name length in bytes
+const maxIndexNameLen = 255
+
+// ErrInvalidIndexName is returned when index name is empty after sanitisation
+var ErrInvalidIndexName = errors.New("invalid index name")
+
+// sanitizeIndexName makes value usable as Elasticsearch/OpenSearch index name:
+// lowercase, without `\ / * ? " < > | , # :` and whitespace (replaced with `_`), not starting with `-`, `_` or `+`, not `.` or `..`.
+func sanitizeIndexName(name string) (string, error) {
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case strings.ContainsRune(`\/*?"<>|,#:`, r), unicode.IsSpace(r), !unicode.IsPrint(r):
+			return '_'
+		}
+		return unicode.ToLower(r)
+	}, name)
+	name = strings.TrimLeft(name, "-_+")
+
+	if len(name) > maxIndexNameLen {
+		name = name[:maxIndexNameLen]
+		for !utf8.ValidString(name) { // do not cut multibyte rune
+			name = name[:len(name)-1]
+		}
+	}
+	if name == "" || name == "." || name == ".." {
+		return "", fmt.Errorf("%w: %q", ErrInvalidIndexName, name)
+	}
+	return name, nil
+}
@@ -0,0 +1,77 @@
+package postgres
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseRowTemplate(t *testing.T) {
+	tests := []struct {
+		name       string
+		src        string
+		wantErr    bool
+		wantFields []string
+		data       map[string]string
+		want       string
+	}{
+		{"static", "products_v2", false, nil, nil, "products_v2"},
+		{"fields", "{{.tenant}}:{{.id}}", false, []string{"tenant", "id"}, map[string]string{"tenant": "acme", "id": "42"}, "acme:42"},
+		{"duplicates", "{{.id}}-{{.id}}", false, []string{"id"}, map[string]string{"id": "1"}, "1-1"},
+		{"pipeline", "{{.schema}}-{{.docType | lower}}", false, []string{"schema", "docType"}, map[string]string{"schema": "public", "docType": "Order"}, "public-order"},
+		{"branches", `{{if .archived}}{{.index}}-archive{{else}}{{.index}}{{end}}`, false, []string{"archived", "index"}, map[string]string{"index": "orders"}, "orders"},
+		{"function args", `{{replace .name " " "_"}}`, false, []string{"name"}, map[string]string{"name": "a b"}, "a_b"},
+		{"missing field", "{{.tenant}}", false, []string{"tenant"}, map[string]string{}, ""},
+		{"syntax error", "{{.tenant", true, nil, nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rt, err := parseRowTemplate("id", tt.src)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseRowTemplate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if !reflect.DeepEqual(rt.fields, tt.wantFields) {
+				t.Errorf("parseRowTemplate() fields = %v, want %v", rt.fields, tt.wantFields)
+			}
+			got, err := rt.execute(tt.data)
+			if err != nil {
+				t.Fatalf("execute() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("execute() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSanitizeIndexName(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    string
+		wantErr bool
+	}{
+		{"orders-acme", "orders-acme", false},
+		{"Orders-ACME", "orders-acme", false},
+		{"orders-a/b c", "orders-a_b_c", false},
+		{"_-+orders", "orders", false},
+		{`orders-"*?<>|,#:\`, "orders-__________", false},
+		{"orders-" + strings.Repeat("é", 200), "orders-" + strings.Repeat("é", 124), false},
+		{"", "", true},
+		{"_", "", true},
+		{"..", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := sanitizeIndexName(tt.name)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("sanitizeIndexName() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("sanitizeIndexName() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
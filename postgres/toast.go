@@ -0,0 +1,141 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pglogrepl"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+var (
+	// ErrNoPK means that row can not be looked up
+	ErrNoPK = errors.New("table has no PK")
+	// ErrRowNotFound means that row does not exist anymore
+	ErrRowNotFound = errors.New("row not found")
+)
+
+var metricToastUnavailable = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "toast_unavailable",
+	Help: "Full documents written without unchanged TOAST values, which could not be fetched",
+}, []string{"table"})
+
+func init() {
+	prometheus.MustRegister(metricToastUnavailable)
+}
+
+// fillUnchangedToast restores unchanged TOAST values of new tuple, when full document is required (E.G: document is re-created).
+// Values are taken from old tuple (REPLICA IDENTITY FULL), otherwise they are selected by PK.
+// Selected values reflect current state of the row, which might be newer than the change; following changes fix it up.
+// Restored columns are decoded. If values can not be restored, warning is logged and fields are omitted.
+func (db *Database) fillUnchangedToast(ctx context.Context, t *Table, oldTuple, newTuple *pglogrepl.TupleData) {
+	var missing keyColumns
+	for _, col := range t.indexColumns() {
+		if col.pos >= len(newTuple.Columns) || newTuple.Columns[col.pos].DataType != pglogrepl.TupleDataTypeToast {
+			continue
+		}
+		if oldTuple != nil && col.pos < len(oldTuple.Columns) {
+			if old := oldTuple.Columns[col.pos]; old.DataType != pglogrepl.TupleDataTypeToast && old.DataType != pglogrepl.TupleDataTypeNull {
+				newTuple.Columns[col.pos] = old
+				col.decode(old.Data, old.DataType)
+				continue
+			}
+		}
+		missing.add(col)
+	}
+	if len(missing) == 0 {
+		return
+	}
+
+	if err := db.selectColumns(ctx, t, missing, newTuple); err != nil {
+		metricToastUnavailable.WithLabelValues(t.name).Inc()
+		t.logger.Warn("unchanged TOAST values are not available; document is written without them. Consider REPLICA IDENTITY FULL",
+			zap.Strings("columns", missing.names()), zap.Error(err))
+	}
+}
+
+// selectColumns fetches current values of columns by PK of the row, and decodes them.
+func (db *Database) selectColumns(ctx context.Context, t *Table, columns keyColumns, tuple *pglogrepl.TupleData) error {
+	var pk keyColumns
+	for _, col := range t.columns {
+		if col.sqlPK {
+			pk.add(col)
+		}
+	}
+	if len(pk) == 0 {
+		pk = t.pkCols
+	}
+	if len(pk) == 0 {
+		return ErrNoPK
+	}
+
+	var q strings.Builder
+	q.WriteString(`SELECT `)
+	for i, col := range columns {
+		if i != 0 {
+			q.WriteByte(',')
+		}
+		q.WriteString(quoteIdent(col.name))
+	}
+	q.WriteString(` FROM `)
+	q.WriteString(quoteIdent(t.schema.name) + "." + quoteIdent(t.name))
+	q.WriteString(` WHERE `)
+
+	params := make([][]byte, len(pk))
+	formats := make([]int16, len(pk))
+	for i, col := range pk {
+		if col.pos >= len(tuple.Columns) {
+			return ErrColumnOutOfRange
+		}
+		if i != 0 {
+			q.WriteString(` AND `)
+		}
+		fmt.Fprintf(&q, `%s = $%d`, quoteIdent(col.name), i+1)
+
+		value := tuple.Columns[col.pos]
+		switch value.DataType {
+		case pglogrepl.TupleDataTypeText:
+			formats[i] = textT
+		case pglogrepl.TupleDataTypeBinary:
+			formats[i] = binT
+		default:
+			return fmt.Errorf("PK column %s value is not available", col.name)
+		}
+		params[i] = value.Data
+	}
+
+	resultFormats := make([]int16, len(columns))
+	for i := range resultFormats {
+		resultFormats[i] = textT
+	}
+
+	db.queryConnMu.Lock()
+	res := db.queryConn.ExecParams(ctx, q.String(), params, nil, formats, resultFormats).Read()
+	db.queryConnMu.Unlock()
+	if res.Err != nil {
+		return fmt.Errorf("select unchanged TOAST values: %w", res.Err)
+	}
+	if len(res.Rows) == 0 {
+		return ErrRowNotFound
+	}
+
+	for i, col := range columns {
+		dataType := uint8(pglogrepl.TupleDataTypeText)
+		if res.Rows[0][i] == nil {
+			dataType = pglogrepl.TupleDataTypeNull
+		}
+		tuple.Columns[col.pos] = &pglogrepl.TupleDataColumn{DataType: dataType, Length: uint32(len(res.Rows[0][i])), Data: res.Rows[0][i]}
+		if err := col.decode(res.Rows[0][i], dataType); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// quoteIdent quotes SQL identifier
+func quoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
@@ -28,6 +28,10 @@ var (
 		Name: "search_doc_size",
 		Help: "Total size of JSON that was pushed to elastic",
 	})
+	metricVersionConflicts = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "search_version_conflicts",
+		Help: "Stale operations (replayed or retried) rejected by version check, and counted as success",
+	})
 	// docs per request
 	// request time
 	// errors // retries
@@ -36,6 +40,7 @@ var (
 func init() {
 	prometheus.MustRegister(metricMessageCount)
 	prometheus.MustRegister(metricMessageSize)
+	prometheus.MustRegister(metricVersionConflicts)
 }
 
 type BulkElasticOpts struct {
@@ -97,6 +102,7 @@ func NewElastic(opts BulkElasticOpts) (es *BulkElastic, err error) {
 		debounceTimer: time.NewTimer(opts.Debounce),
 		// lastReqAt     :time.Now().
 		cond: sync.NewCond(&sync.Mutex{}),
+		done: make(chan struct{}),
 	}
 
 	if es.client, err = NewClient(opts.Host, opts.Username, opts.Password, opts.Logger); err != nil {
@@ -125,6 +131,7 @@ type BulkElastic struct {
 	full           bool
 	debounceStatus debounceStatus
 	shutdown       bool
+	done           chan struct{} // closed after final push
 
 	inqueue pglogrepl.LSN
 
@@ -139,6 +146,9 @@ const (
 	debounceWait
 )
 
+// Start reads documents from stream and pushes them in bulk requests.
+// Graceful shutdown happens, when stream is closed and drained: remaining buffer is pushed.
+// Canceling ctx stops reading from stream; documents which are already buffered are still pushed (and committed).
 func (e *BulkElastic) Start(wg *sync.WaitGroup, ctx context.Context) {
 
 	wg.Add(1)
@@ -155,11 +165,25 @@ func (e *BulkElastic) Start(wg *sync.WaitGroup, ctx context.Context) {
 					continue
 				}
 			}
+			if err == postgres.ErrChClosed { // all documents are received; push the rest and stop
+				e.logger.Info("shutdown: stream is drained")
+				e.cond.L.Lock()
+				e.shutdown = true
+				e.cond.Broadcast()
+				e.cond.L.Unlock()
+				return
+			}
 
-			if err != nil { // postgres.ErrTimeout
+			if err != nil {
 				e.logger.Error("Recv message error", zap.Error(err))
 				return
 			}
+			if ci, ok := msg.(postgres.CreateIndex); ok { // before the first document of the index
+				if err := e.client.CreateIndex(ci.Index); err != nil {
+					e.logger.Error("create index", zap.String("index", ci.Index), zap.Error(err))
+				}
+				continue
+			}
 			if doc, ok := msg.(postgres.Document); ok {
 				metricMessageCount.Inc()
 				e.logger.Debug("document",
@@ -175,6 +199,7 @@ func (e *BulkElastic) Start(wg *sync.WaitGroup, ctx context.Context) {
 	wg.Add(1)
 	go func() { // PUSH / EXEC
 		defer wg.Done()
+		defer close(e.done)
 		errCount := 0
 		// retry := false
 
@@ -230,14 +255,16 @@ func (e *BulkElastic) Start(wg *sync.WaitGroup, ctx context.Context) {
 				break ConditionCheck
 			}
 			// action
-			for err := e.exec(); err != nil; errCount++ {
-				e.logger.Warn("retrying", zap.Int("attempt", errCount+1), zap.Error(err))
-				// TODO: allow adding documents to buffer between retries.
-				time.Sleep(e.throttle)
+			for err := e.exec(); err != nil; err = e.exec() {
 				if errCount >= 2 { // after 3 errors
 					e.logger.Fatal("repeating errors", zap.Int("attempt", errCount+1), zap.Error(err))
 				}
+				errCount++
+				e.logger.Warn("retrying", zap.Int("attempt", errCount+1), zap.Error(err))
+				// TODO: allow adding documents to buffer between retries.
+				time.Sleep(e.throttle)
 			}
+			errCount = 0
 
 			e.lastReqAt = time.Now()
 			e.throttleTimer.Reset(e.throttle)
@@ -265,30 +292,20 @@ func (e *BulkElastic) Start(wg *sync.WaitGroup, ctx context.Context) {
 				e.cond.Broadcast()
 			case <-e.throttleTimer.C: // allows full buffer request
 				e.cond.Broadcast()
-			case <-ctx.Done(): // shutdown
+			case <-ctx.Done(): // abort
 				e.cond.L.Lock()
 				e.shutdown = true
 				e.cond.Broadcast()
 				e.cond.L.Unlock()
 				return
+			case <-e.done: // graceful shutdown
+				return
 			}
 		}
 	}()
 
 }
 
-func (e BulkElastic) push(ctx context.Context) {
-	e.cond.L.Lock()
-	for {
-
-		if e.buf.Len() > 0 {
-
-		}
-	}
-
-	e.cond.L.Unlock()
-}
-
 func (e *BulkElastic) Add(pos pglogrepl.LSN, buffers ...[]byte) error {
 	e.cond.L.Lock()
 	defer e.cond.L.Unlock()
@@ -321,7 +338,9 @@ func (e *BulkElastic) Add(pos pglogrepl.LSN, buffers ...[]byte) error {
 		e.buf.Write(b)
 		e.buf.WriteByte('\n')
 	}
-	e.inqueue = pos
+	if pos != 0 { // backfilled documents have no position
+		e.inqueue = pos
+	}
 	e.cond.Broadcast() // try to unlock push, in case if timers already expired
 
 	return nil
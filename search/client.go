@@ -122,7 +122,9 @@ func (c *Client) Bulk(body io.Reader) error {
 
 	var returnErr error
 	for _, err := range respVal.Errors {
-		c.logger.Warn("push error", zap.String("_id", err.DocID), zap.String("type", err.Type), zap.String("reason", err.Reason))
+		if !err.staleVersion() {
+			c.logger.Warn("push error", zap.String("_id", err.DocID), zap.String("action", err.Action), zap.String("type", err.Type), zap.String("reason", err.Reason))
+		}
 		// TODO (#18): Make response error mapper:
 		// - illegal_argument_exception wrong index mapping
 		// - document_missing_exception ignore?
@@ -132,12 +134,50 @@ func (c *Client) Bulk(body io.Reader) error {
 		if err.Type == "document_missing_exception" {
 			continue
 		}
+		// Stale operation; newer document is already indexed
+		if err.staleVersion() {
+			metricVersionConflicts.Inc()
+			continue
+		}
 		returnErr = ErrBulkCommitFail
 	}
 
 	return returnErr
 }
 
+// CreateIndex creates an empty index, so it's configured by matching index template.
+// Index which already exists is not an error.
+func (c *Client) CreateIndex(name string) error {
+	addr := c.Host.ResolveReference(&url.URL{
+		Path: "/" + url.PathEscape(name),
+	})
+
+	req, err := http.NewRequest("PUT", addr.String(), nil)
+	if err != nil {
+		return fmt.Errorf("prepare create index request: %w", err)
+	}
+
+	resp, err := c.Do(req)
+	if err != nil {
+		return fmt.Errorf("create index request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusBadRequest {
+		respVal := struct {
+			Error BulkRowError `json:"error"`
+		}{}
+		if err := json.NewDecoder(resp.Body).Decode(&respVal); err == nil && respVal.Error.Type == "resource_already_exists_exception" {
+			return nil
+		}
+	}
+	if resp.StatusCode >= 300 {
+		return ErrHTTP{StatusCode: resp.StatusCode}
+	}
+
+	return nil
+}
+
 func (c *Client) Script(id, source string) error {
 	addr := c.Host.ResolveReference(&url.URL{
 		Path: path.Join("/_scripts", id),
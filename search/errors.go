@@ -32,7 +32,7 @@ func (bs *BulkResponseErrors) UnmarshalJSON(b []byte) error {
 
 Items:
 	for _, mapWrapper := range tmp.Items {
-		for _, row := range mapWrapper {
+		for action, row := range mapWrapper {
 			if row == nil {
 				continue Items
 			}
@@ -40,6 +40,7 @@ Items:
 				continue Items
 			}
 			row.Error.DocID = row.ID
+			row.Error.Action = action
 			bs.Errors = append(bs.Errors, *row.Error)
 		}
 	}
@@ -48,10 +49,25 @@ Items:
 
 type BulkRowError struct {
 	DocID  string
+	Action string // bulk operation of item: index, create, update or delete
 	Type   string `json:"type"`
 	Reason string `json:"reason"`
 }
 
+// staleVersion tells whether item is a stale operation, while newer document is already indexed:
+// create of existing document (replayed rows of append only tables), or older external version (replayed or retried changes).
+// Index and delete conflict only if versioned, while conflicts of updates and scripts are real, E.G: concurrent modification.
+func (err BulkRowError) staleVersion() bool {
+	if err.Type != "version_conflict_engine_exception" {
+		return false
+	}
+	switch err.Action {
+	case "create", "index", "delete":
+		return true
+	}
+	return false
+}
+
 func (err BulkRowError) Error() string {
 	return err.Type + ": " + err.Reason
 }
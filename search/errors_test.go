@@ -0,0 +1,34 @@
+package search
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestBulkStaleVersion(t *testing.T) {
+	resp := `{"errors":true,"items":[
+		{"index":{}},
+		{"create":{"error":{"type":"version_conflict_engine_exception"}}},
+		{"index":{"error":{"type":"version_conflict_engine_exception"}}},
+		{"delete":{"error":{"type":"version_conflict_engine_exception"}}},
+		{"update":{"error":{"type":"version_conflict_engine_exception"}}},
+		{"index":{"error":{"type":"mapper_parsing_exception"}}}
+	]}`
+	var errs BulkResponseErrors
+	if err := json.Unmarshal([]byte(resp), &errs); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+
+	want := []struct {
+		action string
+		stale  bool
+	}{{"create", true}, {"index", true}, {"delete", true}, {"update", false}, {"index", false}}
+	if len(errs.Errors) != len(want) {
+		t.Fatalf("errors = %v, want %d", errs.Errors, len(want))
+	}
+	for i, err := range errs.Errors {
+		if err.Action != want[i].action || err.staleVersion() != want[i].stale {
+			t.Errorf("item %d = %s %s stale %v, want %s stale %v", i, err.Action, err.Type, err.staleVersion(), want[i].action, want[i].stale)
+		}
+	}
+}
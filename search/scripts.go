@@ -12,6 +12,9 @@ var (
 	//go:embed scripts/inline_del.painless
 	inlineDelScript string
 
+	//go:embed scripts/inline_soft_del.painless
+	inlineSoftDelScript string
+
 	// might use: // go:embed scripts/inline_add_map.painless
 	// inlineAddMapScript string
 )
@@ -23,6 +26,9 @@ func (e *BulkElastic) PrepareScripts() error {
 	if err := e.client.Script("inline_del", inlineDelScript); err != nil {
 		return fmt.Errorf("prepare inline_del: %w", err)
 	}
+	if err := e.client.Script("inline_soft_del", inlineSoftDelScript); err != nil {
+		return fmt.Errorf("prepare inline_soft_del: %w", err)
+	}
 
 	// Lucene does not support map fields. And there is no way to flaten them.
 	return nil
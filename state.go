@@ -1,8 +1,11 @@
 package main
 
 import (
+	"encoding/json"
 	"net/http"
 	"sync/atomic"
+
+	"github.com/pg2es/search-replica/postgres"
 )
 
 // prototype of healthcheck
@@ -15,3 +18,39 @@ func init() {
 func stateFunc(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte(state.Load().(string)))
 }
+
+// healthFunc responds with 503 status, when replication slot is in critical state
+func healthFunc(db *postgres.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		health, reason := db.SlotHealth()
+		if health == postgres.HealthCritical {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		w.Write([]byte(health.String()))
+		if reason != "" {
+			w.Write([]byte(": " + reason))
+		}
+	}
+}
+
+// reloadFunc re-reads config from comments, and responds with applied changes.
+// Reload is applied by replication between transactions, so request waits for it.
+func reloadFunc(db *postgres.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var report postgres.ReloadReport
+		select {
+		case report = <-db.RequestReload():
+		case <-r.Context().Done():
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if report.Error != "" {
+			w.WriteHeader(http.StatusConflict)
+		}
+		json.NewEncoder(w).Encode(report)
+	}
+}